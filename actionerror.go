@@ -0,0 +1,70 @@
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ActionError is an action failure with details the server can act on, like
+// retrying retryable failures automatically. protocol v1 only has the error
+// reason string, so the details are encoded as a compact prefix of it, see
+// ParseActionError. Code and Category should be short identifiers without
+// spaces, semicolons or brackets.
+type ActionError struct {
+	Code      string
+	Category  string
+	Retryable bool
+	Message   string
+}
+
+func (e *ActionError) Error() string {
+	return fmt.Sprintf("[code=%s;category=%s;retryable=%t] %s", e.Code, e.Category, e.Retryable, e.Message)
+}
+
+// ParseActionError decodes the details of an ActionError from the error
+// reason of an execution result. It returns false for reasons which were not
+// produced by an ActionError.
+func ParseActionError(reason string) (*ActionError, bool) {
+	if !strings.HasPrefix(reason, "[") {
+		return nil, false
+	}
+	end := strings.Index(reason, "] ")
+	if end < 0 {
+		return nil, false
+	}
+	actionErr := &ActionError{Message: reason[end+2:]}
+	for _, field := range strings.Split(reason[1:end], ";") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, false
+		}
+		switch kv[0] {
+		case "code":
+			actionErr.Code = kv[1]
+		case "category":
+			actionErr.Category = kv[1]
+		case "retryable":
+			retryable, err := strconv.ParseBool(kv[1])
+			if err != nil {
+				return nil, false
+			}
+			actionErr.Retryable = retryable
+		default:
+			return nil, false
+		}
+	}
+	return actionErr, true
+}
+
+// errorReason turns the error of an action into the error reason sent to
+// the server. An ActionError anywhere in the chain of wrapped errors is sent
+// in its compact form, so the server can decode the details.
+func errorReason(err error) string {
+	var actionErr *ActionError
+	if errors.As(err, &actionErr) {
+		return actionErr.Error()
+	}
+	return fmt.Sprintf("%v", err)
+}
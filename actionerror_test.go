@@ -0,0 +1,52 @@
+package sdk
+
+import (
+	"fmt"
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/connctd/sdk-go/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestActionErrorReason(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := testutil.NewRecorder()
+	client, _ := NewClient("tcp://test", WithDialer(recorder.Dial))
+	thing := newTestThing("thing1")
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{
+			Name: "calibrate",
+			Execute: func(action Action, params []string) error {
+				return fmt.Errorf("Calibration failed: %w", &ActionError{
+					Code: "SENSOR_BUSY", Category: "device", Retryable: true, Message: "Sensor is busy",
+				})
+			},
+		},
+	}
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+
+	thingId, componentId, actionName, sequence := "thing1", "main", "calibrate", uint64(1)
+	assert.Nil(recorder.Deliver(&protocol.ServerMessage{Action: &protocol.ServerMessage_Execute{
+		Sequence: &sequence,
+		Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+	}}))
+	waitFor(func() bool { return len(recorder.ExecutionResults()) == 1 })
+	reason := recorder.ExecutionResults()[0].GetErrorReason()
+	assert.Equal("[code=SENSOR_BUSY;category=device;retryable=true] Sensor is busy", reason)
+
+	actionErr, ok := ParseActionError(reason)
+	assert.True(ok)
+	assert.Equal(&ActionError{Code: "SENSOR_BUSY", Category: "device", Retryable: true, Message: "Sensor is busy"}, actionErr)
+}
+
+func TestParseActionErrorRejectsPlainReasons(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, reason := range []string{"", "Device offline", "[not] an action error", "[code=X;retryable=maybe] Message"} {
+		_, ok := ParseActionError(reason)
+		assert.False(ok, reason)
+	}
+}
@@ -0,0 +1,72 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// discardConn is a net.Conn dropping everything written to it
+type discardConn struct {
+	writes int
+}
+
+func (c *discardConn) Read(b []byte) (int, error)         { select {} }
+func (c *discardConn) Write(b []byte) (int, error)        { c.writes++; return len(b), nil }
+func (c *discardConn) Close() error                       { return nil }
+func (c *discardConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (c *discardConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (c *discardConn) SetDeadline(t time.Time) error      { return nil }
+func (c *discardConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *discardConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// countingConn counts the writes to the connection it wraps
+type countingConn struct {
+	net.Conn
+	writes int64
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	atomic.AddInt64(&c.writes, 1)
+	return c.Conn.Write(b)
+}
+
+func benchmarkSendThings(b *testing.B, bufferSize int) {
+	// The server end is drained, so writes only cost the pipe
+	server, clientEnd := net.Pipe()
+	go io.Copy(io.Discard, server)
+	defer server.Close()
+	conn := &countingConn{Conn: clientEnd}
+	client, _ := NewClient("tcp://localhost:1234", WithWriteBufferSize(bufferSize),
+		WithDialer(func(ctx context.Context) (net.Conn, error) { return conn, nil }))
+	for i := 0; i < 200; i++ {
+		if err := client.Abstract(newTestThing(fmt.Sprintf("thing%d", i))); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := client.Connect("unit", "token"); err != nil {
+		b.Fatal(err)
+	}
+	defer client.Disconnect()
+	atomic.StoreInt64(&conn.writes, 0)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := client.sendThings(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(atomic.LoadInt64(&conn.writes))/float64(b.N), "writes/op")
+}
+
+func BenchmarkSendThingsDefaultBuffer(b *testing.B) {
+	benchmarkSendThings(b, defaultWriteBufferSize)
+}
+
+func BenchmarkSendThingsLargeBuffer(b *testing.B) {
+	benchmarkSendThings(b, 64*1024)
+}
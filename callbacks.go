@@ -0,0 +1,56 @@
+package sdk
+
+import (
+	"sync"
+)
+
+const maxPendingCallbacks = 100
+
+// callbackQueue runs the connection listeners of a client, like
+// OnDisconnect, OnReconnectAttempt and OnReconnectFailed, outside of the
+// goroutines of the client. Listeners are called one at a time, in the
+// order of the events, on a worker goroutine which only exists while
+// callbacks are pending. A slow listener delays the following ones, but
+// never the client itself. If more than maxPendingCallbacks are pending,
+// further ones are dropped and logged.
+type callbackQueue struct {
+	lock    *sync.Mutex
+	pending []func()
+	running bool
+}
+
+func newCallbackQueue() *callbackQueue {
+	return &callbackQueue{lock: &sync.Mutex{}}
+}
+
+// runCallback queues a listener call
+func (c *Client) runCallback(name string, callback func()) {
+	q := c.callbacks
+	q.lock.Lock()
+	if len(q.pending) >= maxPendingCallbacks {
+		q.lock.Unlock()
+		c.logger.Error("Dropping listener call, too many are pending", F("listener", name))
+		return
+	}
+	q.pending = append(q.pending, callback)
+	if !q.running {
+		q.running = true
+		c.spawn("callbacks", q.work)
+	}
+	q.lock.Unlock()
+}
+
+func (q *callbackQueue) work() {
+	for {
+		q.lock.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.lock.Unlock()
+			return
+		}
+		callback := q.pending[0]
+		q.pending = q.pending[1:]
+		q.lock.Unlock()
+		callback()
+	}
+}
@@ -0,0 +1,95 @@
+package sdk
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBlockingOnDisconnectDoesNotStallClient(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url, WithAutoReconnect(3, 10*time.Millisecond, 10*time.Millisecond))
+	release := make(chan struct{})
+	defer close(release)
+	client.OnDisconnect = func() {
+		<-release
+	}
+	attempts := make(chan int, 10)
+	client.OnReconnectAttempt = func(attempt int, nextDelay time.Duration, lastErr error) {
+		attempts <- attempt
+	}
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+	server.Close()
+
+	// The client reconnects while the disconnect listener still blocks,
+	// the attempt listener has to wait for it
+	select {
+	case server = <-conns:
+	case <-time.After(time.Second):
+		t.Fatal("Client did not reconnect")
+	}
+	assert.NotNil(server.readClientMessage(t).GetHello())
+	assert.Len(attempts, 0)
+	release <- struct{}{}
+	assert.Equal(1, <-attempts)
+}
+
+func TestCallbackQueueOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234")
+	calls := make(chan int, 10)
+	for i := 0; i < 10; i++ {
+		i := i
+		client.runCallback("test", func() { calls <- i })
+	}
+	for i := 0; i < 10; i++ {
+		assert.Equal(i, <-calls)
+	}
+}
+
+// lockingLogger takes a lock whenever an error is logged, which deadlocks
+// if the client logs while holding it
+type lockingLogger struct {
+	lock   *sync.Mutex
+	errors int32
+}
+
+func (l *lockingLogger) Debug(msg string, fields ...Field) {}
+func (l *lockingLogger) Info(msg string, fields ...Field)  {}
+func (l *lockingLogger) Error(msg string, fields ...Field) {
+	l.lock.Lock()
+	l.lock.Unlock()
+	atomic.AddInt32(&l.errors, 1)
+}
+
+func TestDroppedCallbackLogsOutsideQueueLock(t *testing.T) {
+	assert := assert.New(t)
+
+	logger := &lockingLogger{}
+	client, _ := NewClient("tcp://localhost:1234", WithStructuredLogger(logger))
+	logger.lock = client.callbacks.lock
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.runCallback("blocking", func() { <-release })
+		for i := 0; i <= maxPendingCallbacks; i++ {
+			client.runCallback("test", func() {})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Logging a dropped listener call deadlocked")
+	}
+	close(release)
+	assert.True(atomic.LoadInt32(&logger.errors) >= 1)
+}
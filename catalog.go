@@ -0,0 +1,98 @@
+package sdk
+
+import (
+	"fmt"
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/golang/protobuf/proto"
+)
+
+// UnmarshalThings parses a thing list encoded as RequestThingsResponse, as
+// returned by Client.MarshalThings, back into things.
+//
+// The encoding only carries the definition. Execute and OnWrite handlers are
+// lost, so actions have to be bound again before the things are abstracted.
+// Custom value types come back as the builtin type transporting them, and
+// fields protocol version 1 does not transport, like Thing.ComponentType or
+// Property.TTL, are left empty.
+func UnmarshalThings(data []byte) ([]*Thing, error) {
+	response := &protocol.ClientMessage_RequestThingsResponse{}
+	if err := proto.Unmarshal(data, response); err != nil {
+		return nil, err
+	}
+	things := make([]*Thing, 0, len(response.GetThings()))
+	for _, pt := range response.GetThings() {
+		thing, err := thingFromProtocol(pt)
+		if err != nil {
+			return nil, err
+		}
+		things = append(things, thing)
+	}
+	return things, nil
+}
+
+func thingFromProtocol(pt *protocol.Thing) (*Thing, error) {
+	thing := &Thing{
+		Id:              pt.GetId(),
+		Name:            pt.GetName(),
+		Manufacturer:    pt.GetManufacturer(),
+		DisplayType:     pt.GetDisplayType(),
+		MaincomponentId: pt.GetMaincomponentId(),
+	}
+	for _, pa := range pt.GetAttributes() {
+		thing.Attributes = append(thing.Attributes, &Attribute{Name: pa.GetName(), Value: pa.GetValue()})
+	}
+	for _, pc := range pt.GetComponents() {
+		component := &Component{
+			Id:            pc.GetId(),
+			Name:          pc.GetName(),
+			ComponentType: pc.GetComponentType(),
+		}
+		var err error
+		if component.Properties, err = propertiesFromProtocol(pc.GetProperties()); err != nil {
+			return nil, err
+		}
+		if component.Actions, err = actionsFromProtocol(pc.GetActions()); err != nil {
+			return nil, err
+		}
+		for _, pcap := range pc.GetCapabilities() {
+			capability := &Capability{Id: pcap.GetId()}
+			if capability.Properties, err = propertiesFromProtocol(pcap.GetProperties()); err != nil {
+				return nil, err
+			}
+			if capability.Actions, err = actionsFromProtocol(pcap.GetActions()); err != nil {
+				return nil, err
+			}
+			component.Capabilities = append(component.Capabilities, capability)
+		}
+		thing.Components = append(thing.Components, component)
+	}
+	return thing, nil
+}
+
+func propertiesFromProtocol(pps []*protocol.Property) ([]*Property, error) {
+	properties := make([]*Property, 0, len(pps))
+	for _, pp := range pps {
+		value, err := ValueFromProtocol(pp.GetValue(), LenientValueTypes)
+		if err != nil {
+			return nil, fmt.Errorf("Property %s: %v", pp.GetName(), err)
+		}
+		properties = append(properties, &Property{Name: pp.GetName(), Value: value})
+	}
+	return properties, nil
+}
+
+func actionsFromProtocol(pas []*protocol.Action) ([]*Action, error) {
+	actions := make([]*Action, 0, len(pas))
+	for _, pa := range pas {
+		action := &Action{Name: pa.GetName()}
+		for _, pp := range pa.GetParameters() {
+			valueType, err := valueTypeFromProtocol(pp.ValueType, LenientValueTypes)
+			if err != nil {
+				return nil, fmt.Errorf("Parameter %s of action %s: %v", pp.GetName(), pa.GetName(), err)
+			}
+			action.Parameters = append(action.Parameters, &ActionParameter{Name: pp.GetName(), Type: &valueType})
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
@@ -0,0 +1,53 @@
+package sdk
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUnmarshalThingsRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	number := Number
+	thing := newTestThing("thing1")
+	thing.DisplayType = "sensor"
+	thing.Attributes = []*Attribute{{Name: "serial", Value: "123"}}
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{
+			Name:       "calibrate",
+			Parameters: []*ActionParameter{{Name: "offset", Type: &number}},
+			Execute:    func(action Action, params []string) error { return nil },
+		},
+	}
+	client, _ := NewClient("tcp://localhost:1234")
+	assert.Nil(client.Abstract(thing))
+	data, err := client.MarshalThings()
+	assert.Nil(err)
+
+	things, err := UnmarshalThings(data)
+	assert.Nil(err)
+	assert.Len(things, 1)
+	parsed := things[0]
+	assert.Equal("thing1", parsed.Id)
+	assert.Equal("sensor", parsed.DisplayType)
+	assert.Equal("main", parsed.MaincomponentId)
+	assert.Equal([]*Attribute{{Name: "serial", Value: "123"}}, parsed.Attributes)
+	capability := parsed.GetComponent("main").GetCapability("temperature")
+	assert.Equal(&Value{Type: Number, Symbol: "C"}, capability.GetProperty("value").Value)
+	action := capability.Actions[0]
+	assert.Equal("calibrate", action.Name)
+	assert.Equal(Number, *action.Parameters[0].Type)
+	assert.Nil(action.Execute)
+
+	// The parsed things marshal to the same bytes
+	other, _ := NewClient("tcp://localhost:1234")
+	assert.Nil(other.Abstract(things...))
+	again, err := other.MarshalThings()
+	assert.Nil(err)
+	assert.Equal(data, again)
+}
+
+func TestUnmarshalThingsInvalidData(t *testing.T) {
+	_, err := UnmarshalThings([]byte{0xff, 0xff})
+	assert.Error(t, err)
+}
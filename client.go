@@ -2,130 +2,732 @@ package sdk
 
 import (
 	"bufio"
-	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/connctd/sdk-go/protocol"
 	"github.com/golang/protobuf/proto"
-	"log"
 	"net"
-	"net/url"
 	"regexp"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
 	PROTOCOL_VERSION uint64 = 1
 
 	validNameRegexp = regexp.MustCompile("^[A-Za-z0-9]+$")
+
+	// ErrNotConnected is returned when sending a message without an
+	// established connection
+	ErrNotConnected = errors.New("Client is not connected")
+	// ErrDispatchStalled is recorded when received messages could not be
+	// handed to the message handler in time and the connection was closed
+	ErrDispatchStalled = errors.New("Message dispatcher is stalled")
+
+	// ErrMessageTooLarge is returned when a message exceeds the maximum
+	// message size
+	ErrMessageTooLarge = errors.New("Message too large")
+
+	defaultDispatchTimeout = 10 * time.Second
+	defaultMaxMessageSize  = 16 * 1024 * 1024
+	defaultWriteBufferSize = 4096
+	errorLogInterval       = 10 * time.Second
 )
 
+// receivedMessage is a server message together with the time it was read
+// from the connection
+type receivedMessage struct {
+	msg        protocol.ServerMessage
+	receivedAt time.Time
+}
+
 type OnDisconnectListener func()
 
+// OnRequestThingsListener is notified about RequestThings messages when
+// things are pushed manually
+type OnRequestThingsListener func()
+
+// ClientStatus is a consistent snapshot of the state of a Client,
+// suitable for health checks
+type ClientStatus struct {
+	Connected         bool
+	RemoteAddr        string
+	Things            int
+	LastError         error
+	LastDisconnect    time.Time
+	ReconnectAttempts int
+	ProtocolVersion   uint64
+}
+
+// ServerInfo describes the hello the server answered the client hello with.
+// The server hello of protocol version 1 only tells whether the connection
+// was accepted and why not, it carries no version, session or limits.
+type ServerInfo struct {
+	Connected    bool
+	ErrorMessage string
+	// ReceivedAt is the time the hello was received, it is zero if no
+	// hello was received yet
+	ReceivedAt time.Time
+}
+
 type Client struct {
+	// goroutines counts the running internal goroutines, bytesRead and
+	// bytesWritten the transferred bytes. They are accessed atomically and
+	// kept first for 64 bit alignment.
+	goroutines    int64
+	bytesRead     uint64
+	bytesWritten  uint64
 	conn          net.Conn
 	host          string
 	writer        *bufio.Writer
-	receiveChan   chan protocol.ServerMessage
+	receiveChan   chan receivedMessage
 	things        []*Thing
+	thingsLock    *sync.Mutex
+	schema        *Schema
 	updateCounter uint64
-	updateLock    *sync.Mutex
-	OnDisconnect  OnDisconnectListener
+	// acknowledgedUpdateLock is guarded by updateLock
+	acknowledgedUpdateLock uint64
+	updateLock             *sync.Mutex
+	writeLock              *sync.Mutex
+	// OnDisconnect is called when the connection was lost. Like the other
+	// connection listeners OnReconnectAttempt and OnReconnectFailed it is
+	// called on a separate goroutine, one listener call at a time in the
+	// order of the events, so listeners may block without stalling the
+	// client.
+	OnDisconnect OnDisconnectListener
+	// OnRequestThings is called when the server requests the thing list
+	// and the client was created WithManualThingPush. Like the connection
+	// listeners it is called on a separate goroutine, so it may push the
+	// things right away.
+	OnRequestThings OnRequestThingsListener
+	// OnPropertyChanged is called after a changed property value was sent
+	// to the server
+	OnPropertyChanged func(path protocol.Path, old, new string)
+	// OnReconnectAttempt is called before each reconnect attempt with the
+	// delay before the attempt and the error of the previous one
+	OnReconnectAttempt func(attempt int, nextDelay time.Duration, lastErr error)
+	// OnReconnectFailed is called when reconnecting was given up
+	OnReconnectFailed func(attempts int, lastErr error)
+	// OnThingsPushed is called after the thing list was sent to the server
+	// with the update lock and the number of things sent
+	OnThingsPushed func(updateLock uint64, count int)
+	// OnActionReceived is called for every received Execute message before
+	// it is handled, also for unknown actions and while the client is paused
+	// or draining. It is called on the message handling goroutine, so it
+	// should return quickly. params is nil if the parameters exceed the
+	// limits set via WithMaxActionParameters.
+	OnActionReceived func(path protocol.Path, params []string, sequence uint64)
+	// OnServerError is called when the server rejected a message. Protocol
+	// version 1 only reports errors in the server hello, which rejects the
+	// client hello. If the client was created WithTracing, rejected holds
+	// the serialized ClientMessage carrying that hello, otherwise it is nil.
+	OnServerError func(errorMsg string, rejected []byte)
+	// UserData holds arbitrary application data, like a tenant or site,
+	// so callbacks shared by several clients can identify the client. It
+	// is not used by the client itself.
+	UserData interface{}
+
+	// stateLock guards the connection state below
+	stateLock         *sync.Mutex
+	connected         bool
+	remoteAddr        string
+	lastErr           error
+	lastDisconnect    time.Time
+	reconnectAttempts int
+	protocolVersion   uint64
 
-	connected bool
+	requestThingsDebounce time.Duration
+	numberFormat          NumberFormat
+	pushLock              *sync.Mutex
+	pushPending           bool
+
+	// closed is set when the application disconnected the client, stop is
+	// closed along with it
+	closed        bool
+	stop          chan struct{}
+	unitId        string
+	token         string
+	reconnect     *reconnectConfig
+	reconnectStop chan struct{}
+	reconnecting  bool
+	// draining and runningActions are guarded by stateLock
+	draining       bool
+	runningActions int
+	// messageHandlers overrides the built-in message handling, guarded by
+	// stateLock
+	messageHandlers map[MessageType]MessageHandler
+	// paused, resuming and pausedActions are guarded by stateLock
+	paused        bool
+	resuming      bool
+	pausedActions []receivedMessage
+	pauseMode     PauseMode
+	// serverInfo and undeliveredResults are guarded by stateLock
+	serverInfo         ServerInfo
+	undeliveredResults []undeliveredResult
+	resultRetention    time.Duration
+	callbacks          *callbackQueue
+	metrics            Metrics
+	sendQueue          *sendQueue
+	dialer             func(ctx context.Context) (net.Conn, error)
+	// done is closed when the current connection is torn down,
+	// handlerDone when the message handler of the latest connection
+	// exited, both guarded by stateLock
+	done            chan struct{}
+	handlerDone     chan struct{}
+	helloChan       chan *protocol.ServerMessage_ServerHello
+	dispatchTimeout time.Duration
+	readTimeout     time.Duration
+	actionHistory   *actionHistory
+	manualThingPush bool
+	logger          StructuredLogger
+	// errorLog throttles the errors logged by the read and reconnect loops
+	errorLog        *logThrottle
+	maxMessageSize  int
+	writeBufferSize int
+	// preallocate is the expected size of the thing list, marshalBuf is
+	// reused for marshalling messages and guarded by writeLock
+	preallocate int
+	marshalBuf  *proto.Buffer
+	// tracing keeps the bytes of sent messages the server can reject,
+	// tracedHello is guarded by stateLock
+	tracing     bool
+	tracedHello []byte
+	// insecureSkipVerify disables TLS certificate verification
+	insecureSkipVerify    bool
+	pinnedFingerprint     string
+	thingProvider         ThingProvider
+	maxConnectionAge      time.Duration
+	maxThings             int
+	maxComponentsPerThing int
+	// providedThings holds the Ids of the things returned by the thing
+	// provider, guarded by thingsLock
+	providedThings map[string]bool
+	isolation      *thingIsolation
+
+	knownDisplayTypes   map[string]bool
+	knownComponentTypes map[string]bool
+	strictTypes         bool
+	strictValues        bool
+	maxParameters       int
+	// unhandledActionHandler answers Execute messages for unknown actions
+	unhandledActionHandler UnhandledActionHandler
+	maxParametersSize      int
+	sendRetries            int
+	handlerWatchdog        time.Duration
+	customFrameCodec       FrameCodec
+	receivePolicy          ReceiveOverflowPolicy
+	receiveOverflow        *receiveOverflow
+	sendRetryDelay         time.Duration
+	resultCache            *resultCache
+	collisionPolicy        CollisionPolicy
 }
 
-func NewClient(url string) (*Client, error) {
+func NewClient(url string, options ...Option) (*Client, error) {
 	client := &Client{
-		host:        url,
-		receiveChan: make(chan protocol.ServerMessage, 10),
-		things:      make([]*Thing, 0, 10),
-		connected:   false,
-		updateLock:  &sync.Mutex{},
+		host:            url,
+		receiveChan:     make(chan receivedMessage, 10),
+		things:          make([]*Thing, 0, 10),
+		connected:       false,
+		thingsLock:      &sync.Mutex{},
+		updateLock:      &sync.Mutex{},
+		writeLock:       &sync.Mutex{},
+		stateLock:       &sync.Mutex{},
+		pushLock:        &sync.Mutex{},
+		numberFormat:    defaultNumberFormat,
+		dispatchTimeout: defaultDispatchTimeout,
+		isolation:       newThingIsolation(0),
+		logger:          NewPrintfLogger(stdLogger{}, false),
+		errorLog:        newLogThrottle(errorLogInterval),
+		maxMessageSize:  defaultMaxMessageSize,
+		writeBufferSize: defaultWriteBufferSize,
+		resultRetention: defaultResultRetention,
+		callbacks:       newCallbackQueue(),
+		metrics:         noopMetrics{},
+	}
+	for _, option := range options {
+		option(client)
+	}
+	if client.preallocate > 0 {
+		client.marshalBuf = proto.NewBuffer(make([]byte, 0, client.preallocate))
+		if client.writeBufferSize < client.preallocate+binary.MaxVarintLen64 {
+			client.writeBufferSize = client.preallocate + binary.MaxVarintLen64
+		}
 	}
 	return client, nil
 }
 
+// Connect connects to the server and sends the hello. It returns as soon
+// as the hello was sent, without waiting for the server to accept it.
 func (c *Client) Connect(unitId, token string) error {
-	var err error
+	c.setCredentials(unitId, token)
+	return c.connect(context.Background(), unitId, token, false, nil)
+}
 
-	connUrl, err := url.Parse(c.host)
-	if err != nil {
-		return err
-	}
+// ConnectContext connects to the server and waits until the server accepted
+// the hello. If the context is done before, the connection is torn down
+// and the context error is returned.
+func (c *Client) ConnectContext(ctx context.Context, unitId, token string) error {
+	c.setCredentials(unitId, token)
+	return c.connect(ctx, unitId, token, true, nil)
+}
 
-	switch connUrl.Scheme {
-	case "tcp":
-		c.conn, err = net.Dial("tcp", connUrl.Host)
-	case "ssl":
-		tlsConf := &tls.Config{}
-		c.conn, err = tls.Dial("tcp", connUrl.Host, tlsConf)
+// setCredentials remembers the credentials for reconnecting and marks the
+// client as intended to be connected
+func (c *Client) setCredentials(unitId, token string) {
+	c.stateLock.Lock()
+	c.unitId = unitId
+	c.token = token
+	if c.closed || c.stop == nil {
+		c.stop = make(chan struct{})
 	}
+	c.closed = false
+	c.stateLock.Unlock()
+}
 
+// connect dials the server and makes the new connection the current one.
+// replaces is the done channel of the connection a cycle replaces, nil
+// otherwise. If the application disconnected while dialing, or the
+// connection to replace is gone, the new connection is closed and
+// ErrNotConnected is returned.
+func (c *Client) connect(ctx context.Context, unitId, token string, waitForHello bool, replaces chan struct{}) error {
+	conn, err := c.dial(ctx)
 	if err != nil {
+		// A failed cycle keeps the current connection, which is healthy
+		if replaces == nil {
+			c.recordError(err)
+		}
 		return err
 	}
-	c.writer = bufio.NewWriter(c.conn)
 
 	hello := &protocol.ClientMessage_ClientHello{
 		UnitId:          &unitId,
 		Token:           &token,
 		ProtocolVersion: &PROTOCOL_VERSION,
 	}
-	go c.read()
-	go c.handleServerMessages()
+	done := make(chan struct{})
+	helloChan := make(chan *protocol.ServerMessage_ServerHello, 1)
+	c.writeLock.Lock()
+	c.stateLock.Lock()
+	if c.closed || (replaces != nil && (c.draining || c.done != replaces)) {
+		c.stateLock.Unlock()
+		c.writeLock.Unlock()
+		conn.Close()
+		return ErrNotConnected
+	}
+	c.conn = conn
+	// Counting below the buffer only counts bytes which reached the
+	// connection
+	c.writer = bufio.NewWriterSize(countingWriter{w: conn, count: &c.bytesWritten}, c.writeBufferSize)
+	c.writeLock.Unlock()
+	c.done = done
+	c.helloChan = helloChan
+	c.draining = false
+	// queued actions belong to the previous connection
+	c.pausedActions = nil
 	c.connected = true
+	c.remoteAddr = conn.RemoteAddr().String()
+	c.protocolVersion = PROTOCOL_VERSION
+	// While a connection is cycled the previous one is still open, its
+	// handler has to exit before the new one starts, so messages are
+	// handled one at a time
+	previousHandler := c.handlerDone
+	handlerDone := make(chan struct{})
+	c.handlerDone = handlerDone
+	c.stateLock.Unlock()
+	c.spawn("read", func() { c.read(conn, done) })
+	c.spawn("handleServerMessages", func() {
+		defer close(handlerDone)
+		if previousHandler != nil {
+			<-previousHandler
+		}
+		// Sequences of the previous connection are done with once its
+		// handler returned
+		if c.resultCache != nil {
+			c.resultCache.reset()
+		}
+		c.handleServerMessages(done)
+	})
+	if c.maxConnectionAge > 0 {
+		c.spawn("expireConnection", func() { c.expireConnection(conn, done) })
+	}
 	if err := c.send(&protocol.ClientMessage{Hello: hello}); err != nil {
 		return err
 	}
-	return nil
+	if !waitForHello {
+		return nil
+	}
+
+	select {
+	case serverHello := <-helloChan:
+		if serverHello.GetConnected() {
+			return nil
+		}
+		c.Disconnect()
+		return fmt.Errorf("Server refused connection: %s", serverHello.GetErrorMsg())
+	case <-done:
+		return ErrNotConnected
+	case <-ctx.Done():
+		c.Disconnect()
+		return ctx.Err()
+	}
 }
 
 func (c *Client) Disconnect() error {
 	// TODO send disconnect message
-	c.connected = false
-	return c.conn.Close()
+	c.stateLock.Lock()
+	if !c.closed && c.stop != nil {
+		close(c.stop)
+	}
+	c.closed = true
+	if c.reconnectStop != nil {
+		close(c.reconnectStop)
+		c.reconnectStop = nil
+	}
+	done := c.done
+	c.stateLock.Unlock()
+	c.teardown(done)
+	c.thingsLock.Lock()
+	things := append([]*Thing(nil), c.things...)
+	c.thingsLock.Unlock()
+	stopRefreshing(things...)
+	c.writeLock.Lock()
+	conn := c.conn
+	c.writeLock.Unlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	// The read loop closes the connection itself when it stops, which may
+	// race with the teardown above
+	if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// DisconnectWithDrain stops handling new server messages, answering new
+// actions with FAILURE, waits up to the timeout for running actions to
+// finish and send their results and closes the connection afterwards. If
+// actions are still running when the timeout expires, the connection is
+// closed anyway and an error reporting the number of running actions is
+// returned.
+func (c *Client) DisconnectWithDrain(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return c.disconnectWithDrain(ctx)
+}
+
+// disconnectWithDrain drains the running actions until the context is done
+// and disconnects afterwards
+func (c *Client) disconnectWithDrain(ctx context.Context) error {
+	c.stateLock.Lock()
+	c.draining = true
+	c.stateLock.Unlock()
+
+	running := c.runningActionCount()
+	for running > 0 && ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case <-time.After(10 * time.Millisecond):
+		}
+		running = c.runningActionCount()
+	}
+	err := c.Disconnect()
+	if running > 0 {
+		return fmt.Errorf("Disconnected with %d actions still running", running)
+	}
+	return err
+}
+
+func (c *Client) runningActionCount() int {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	return c.runningActions
+}
+
+// startAction registers a running action, unless the client is draining
+func (c *Client) startAction() bool {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	if c.draining {
+		return false
+	}
+	c.runningActions++
+	return true
+}
+
+func (c *Client) finishAction() {
+	c.stateLock.Lock()
+	c.runningActions--
+	c.stateLock.Unlock()
 }
 
 func (c *Client) IsConnected() bool {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
 	return c.connected
 }
 
+// Status returns a snapshot of the current client state. Both locks are
+// held together, thingsLock first, so all fields are from the same moment.
+func (c *Client) Status() ClientStatus {
+	c.thingsLock.Lock()
+	defer c.thingsLock.Unlock()
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	status := ClientStatus{
+		Connected:         c.connected,
+		Things:            len(c.things),
+		LastError:         c.lastErr,
+		LastDisconnect:    c.lastDisconnect,
+		ReconnectAttempts: c.reconnectAttempts,
+		ProtocolVersion:   c.protocolVersion,
+	}
+	if c.connected {
+		status.RemoteAddr = c.remoteAddr
+	}
+	return status
+}
+
+func (c *Client) recordError(err error) {
+	c.stateLock.Lock()
+	c.lastErr = err
+	c.stateLock.Unlock()
+}
+
+// teardown signals the goroutines of the connection identified by done to
+// stop and marks the client as disconnected if it is the current one. It
+// returns false if the connection was already torn down.
+func (c *Client) teardown(done chan struct{}) bool {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	if done == nil {
+		return false
+	}
+	if c.done == done {
+		if c.connected {
+			c.lastDisconnect = time.Now()
+		}
+		c.connected = false
+	}
+	select {
+	case <-done:
+		return false
+	default:
+		close(done)
+		// Messages queued by this connection must not be handled on the
+		// next one
+		if c.receiveOverflow != nil {
+			c.receiveOverflow.clear(done)
+		}
+		return true
+	}
+}
+
+// validateThing validates a thing which is about to be added to the
+// abstracted things. The caller must hold the things lock.
 func (c *Client) validateThing(t *Thing) error {
 	for _, thing := range c.things {
 		if thing.Id == t.Id {
 			return fmt.Errorf("The thing with the Id %s already exists", t.Id)
 		}
 	}
+	return c.validateDefinition(t)
+}
+
+// validateDefinition validates the definition of a thing on its own
+func (c *Client) validateDefinition(t *Thing) error {
+	if c.maxComponentsPerThing > 0 && len(t.Components) > c.maxComponentsPerThing {
+		return fmt.Errorf("Thing %s has %d components, the maximum is %d",
+			t.Id, len(t.Components), c.maxComponentsPerThing)
+	}
 	for _, component := range t.Components {
-		for _, property := range component.Properties {
-			if !validNameRegexp.MatchString(property.Name) {
-				return fmt.Errorf("%s is an invalid name for a property", property.Name)
+		if err := validateMembers(component.Properties, component.Actions); err != nil {
+			return err
+		}
+		for _, capability := range component.Capabilities {
+			if err := validateMembers(capability.Properties, capability.Actions); err != nil {
+				return err
 			}
 		}
+	}
+	if err := validateMainComponent(t); err != nil {
+		return err
+	}
+	if err := validateLinks(t); err != nil {
+		return err
+	}
+	if err := c.validateTypes(t); err != nil {
+		return err
+	}
+	if c.collisionPolicy == RejectCollisions {
+		if err := validatePropertyNamesUnique(t); err != nil {
+			return err
+		}
+		if err := validateActionNamesUnique(t); err != nil {
+			return err
+		}
+	}
+	// TODO Validate more stuff, but we have to decide what
+	return nil
+}
 
-		for _, action := range component.Actions {
-			if !validNameRegexp.MatchString(action.Name) {
-				return fmt.Errorf("%s is an invalid name for an action", action.Name)
+// validateMembers validates the properties and actions of a component or
+// capability
+func validateMembers(properties []*Property, actions []*Action) error {
+	for _, property := range properties {
+		if !validNameRegexp.MatchString(property.Name) {
+			return fmt.Errorf("%s is an invalid name for a property", property.Name)
+		}
+		if property.Value == nil {
+			return fmt.Errorf("Property %s has no value", property.Name)
+		}
+		if err := property.Value.Validate(); err != nil {
+			return fmt.Errorf("Property %s: %v", property.Name, err)
+		}
+	}
+	for _, action := range actions {
+		if !validNameRegexp.MatchString(action.Name) {
+			return fmt.Errorf("%s is an invalid name for an action", action.Name)
+		}
+		for _, param := range action.Parameters {
+			if err := param.Validate(); err != nil {
+				return fmt.Errorf("Action %s: %v", action.Name, err)
 			}
 		}
+	}
+	return nil
+}
+
+// checkThingCount returns an error if the number of things exceeds the
+// limit set via WithMaxThings
+func (c *Client) checkThingCount(count int) error {
+	if c.maxThings > 0 && count > c.maxThings {
+		return fmt.Errorf("Too many things: %d things exceed the maximum of %d", count, c.maxThings)
+	}
+	return nil
+}
+
+// validateMainComponent ensures the main component exists and matches the
+// component type declared by the thing
+func validateMainComponent(t *Thing) error {
+	if t.MaincomponentId == "" {
+		return nil
+	}
+	main := t.GetComponent(t.MaincomponentId)
+	if main == nil {
+		return fmt.Errorf("The main component %s of thing %s does not exist", t.MaincomponentId, t.Id)
+	}
+	if t.ComponentType != "" && main.ComponentType != t.ComponentType {
+		return fmt.Errorf("The main component %s of thing %s has type %s but the thing declares %s",
+			main.Id, t.Id, main.ComponentType, t.ComponentType)
+	}
+	return nil
+}
 
+// validatePropertyNamesUnique ensures property names are unique within each
+// component. Property paths only consist of thing Id, component Id and
+// property name, so properties with the same name in different
+// capabilities of a component could not be told apart by the server.
+func validatePropertyNamesUnique(t *Thing) error {
+	for _, component := range t.Components {
+		names := make(map[string]bool)
+		for _, property := range component.Properties {
+			if names[property.Name] {
+				return fmt.Errorf("Property %s exists more than once in component %s", property.Name, component.Id)
+			}
+			names[property.Name] = true
+		}
 		for _, capability := range component.Capabilities {
 			for _, property := range capability.Properties {
-				if !validNameRegexp.MatchString(property.Name) {
-					return fmt.Errorf("%s is an invalid name for a property", property.Name)
+				if names[property.Name] {
+					return fmt.Errorf("Property %s of capability %s collides with another property in component %s",
+						property.Name, capability.Id, component.Id)
 				}
+				names[property.Name] = true
 			}
+		}
+	}
+	return nil
+}
 
+// validateLinks ensures component links have a valid relation and point to
+// another component of the same thing
+func validateLinks(t *Thing) error {
+	for _, component := range t.Components {
+		for _, link := range component.Links {
+			if !validNameRegexp.MatchString(link.Relation) {
+				return fmt.Errorf("%s is an invalid relation for a link of component %s", link.Relation, component.Id)
+			}
+			if link.Target == component.Id {
+				return fmt.Errorf("Component %s links to itself", component.Id)
+			}
+			if t.GetComponent(link.Target) == nil {
+				return fmt.Errorf("Component %s links to the component %s, which does not exist in thing %s",
+					component.Id, link.Target, t.Id)
+			}
+		}
+	}
+	return nil
+}
+
+// validateActionNamesUnique ensures action names are unique per component.
+// Execute messages address actions by thing Id, component Id and action
+// name only, so same-named actions in different capabilities could not be
+// told apart.
+func validateActionNamesUnique(t *Thing) error {
+	for _, component := range t.Components {
+		names := make(map[string]bool)
+		for _, action := range component.Actions {
+			if names[action.Name] {
+				return fmt.Errorf("Action %s exists more than once in component %s", action.Name, component.Id)
+			}
+			names[action.Name] = true
+		}
+		for _, capability := range component.Capabilities {
 			for _, action := range capability.Actions {
-				if !validNameRegexp.MatchString(action.Name) {
-					return fmt.Errorf("%s is an invalid name for an action", action.Name)
+				if names[action.Name] {
+					return fmt.Errorf("Action %s of capability %s collides with another action in component %s",
+						action.Name, capability.Id, component.Id)
 				}
+				names[action.Name] = true
 			}
 		}
 	}
-	// TODO Validate more stuff, but we have to decide what
+	return nil
+}
+
+// validateTypes checks display and component types against the known types
+// configured via WithKnownTypes. Unknown types are an error in strict mode
+// and logged otherwise.
+func (c *Client) validateTypes(t *Thing) error {
+	var unknown []string
+	if c.knownDisplayTypes != nil && t.DisplayType != "" && !c.knownDisplayTypes[t.DisplayType] {
+		unknown = append(unknown, fmt.Sprintf("%s is an unknown display type", t.DisplayType))
+	}
+	if c.knownComponentTypes != nil {
+		if t.ComponentType != "" && !c.knownComponentTypes[t.ComponentType] {
+			unknown = append(unknown, fmt.Sprintf("%s is an unknown component type", t.ComponentType))
+		}
+		for _, component := range t.Components {
+			if component.ComponentType != "" && !c.knownComponentTypes[component.ComponentType] {
+				unknown = append(unknown, fmt.Sprintf("%s is an unknown component type for component %s", component.ComponentType, component.Id))
+			}
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	if c.strictTypes {
+		return fmt.Errorf("Thing %s: %s", t.Id, strings.Join(unknown, ", "))
+	}
+	for _, msg := range unknown {
+		c.logger.Info(msg, F("thing", t.Id))
+	}
 	return nil
 }
 
@@ -134,28 +736,55 @@ func (c *Client) abstract(t *Thing) error {
 	if err := c.validateThing(t); err != nil {
 		return err
 	}
+	if err := c.checkThingCount(len(c.things) + 1); err != nil {
+		return err
+	}
+	c.wire(t)
+	c.things = append(c.things, t)
+	return nil
+}
+
+// wire sets the client and parent pointers of everything below the thing
+func (c *Client) wire(t *Thing) {
 	// Set client to all Properties, so the property can
 	// automatically send property changes
+	t.client = c
 	for _, component := range t.Components {
 		component.parent = t
 		for _, property := range component.Properties {
 			property.client = c
 		}
-		// Set the respective parents so properties can create their paths
-		// for property update messages
-		for _, capability := range component.Capabilities {
-			for _, property := range capability.Properties {
-				property.client = c
-				property.parent = capability
+		for _, action := range component.Actions {
+			action.client = c
+			if action.last == nil {
+				action.last = &actionResult{}
 			}
-			capability.parent = component
+		}
+		for _, capability := range component.Capabilities {
+			c.wireCapability(component, capability)
 		}
 	}
-	c.things = append(c.things, t)
-	return nil
+}
+
+// wireCapability sets the respective parents so properties can create
+// their paths for property update messages
+func (c *Client) wireCapability(component *Component, capability *Capability) {
+	for _, property := range capability.Properties {
+		property.client = c
+		property.parent = capability
+	}
+	for _, action := range capability.Actions {
+		action.client = c
+		if action.last == nil {
+			action.last = &actionResult{}
+		}
+	}
+	capability.parent = component
 }
 
 func (c *Client) Abstract(things ...*Thing) error {
+	c.thingsLock.Lock()
+	defer c.thingsLock.Unlock()
 	for _, thing := range things {
 		if err := c.abstract(thing); err != nil {
 			return err
@@ -165,108 +794,487 @@ func (c *Client) Abstract(things ...*Thing) error {
 }
 
 func (c *Client) RemoveThing(t *Thing) error {
-	var thing *Thing
-	var i int
-	for i, thing = range c.things {
+	c.thingsLock.Lock()
+	for i, thing := range c.things {
 		if thing.Id == t.Id {
+			c.things = append(c.things[:i], c.things[i+1:]...)
+			c.thingsLock.Unlock()
+			stopRefreshing(thing)
+			return nil
+		}
+	}
+	c.thingsLock.Unlock()
+	return fmt.Errorf("Thing with Id %s not found", t.Id)
+}
+
+// refreshesProperty reports whether the TTL of the property is still kept
+// up, which ends when the application disconnects the client or the thing
+// of the property is no longer abstracted
+func (c *Client) refreshesProperty(p *Property) bool {
+	if p.parent == nil || p.parent.parent == nil || p.parent.parent.parent == nil {
+		return false
+	}
+	c.stateLock.Lock()
+	closed := c.closed
+	c.stateLock.Unlock()
+	thing := p.parent.parent.parent
+	return !closed && c.getThing(thing.Id) == thing
+}
+
+// UpsertThing replaces the abstracted thing with the same Id or adds the
+// thing if no such thing exists. If the client is connected the updated
+// thing list is pushed to the server.
+func (c *Client) UpsertThing(t *Thing) error {
+	if err := c.validateDefinition(t); err != nil {
+		return err
+	}
+	c.thingsLock.Lock()
+	index := -1
+	for i, thing := range c.things {
+		if thing.Id == t.Id {
+			index = i
 			break
 		}
 	}
-	if i >= len(c.things) {
-		return fmt.Errorf("Thing with Id %s not found", t.Id)
+	if index < 0 {
+		if err := c.checkThingCount(len(c.things) + 1); err != nil {
+			c.thingsLock.Unlock()
+			return err
+		}
+	}
+	c.wire(t)
+	var replaced *Thing
+	if index >= 0 {
+		replaced = c.things[index]
+		c.things[index] = t
+	} else {
+		c.things = append(c.things, t)
 	}
-	c.things = append(c.things[:i], c.things[i+1:]...)
-	return nil
+	c.thingsLock.Unlock()
+	if replaced != nil && replaced != t {
+		stopRefreshing(replaced)
+	}
+
+	if !c.IsConnected() {
+		return nil
+	}
+	return c.sendThings()
+}
+
+// SetThings replaces all abstracted things with the given set. The whole
+// set is validated first and nothing is changed if any thing is invalid.
+// If the client is connected the new thing list is pushed to the server.
+func (c *Client) SetThings(things ...*Thing) error {
+	if err := c.checkThingCount(len(things)); err != nil {
+		return err
+	}
+	ids := make(map[string]bool, len(things))
+	for _, thing := range things {
+		if ids[thing.Id] {
+			return fmt.Errorf("The thing with the Id %s already exists", thing.Id)
+		}
+		ids[thing.Id] = true
+		if err := c.validateDefinition(thing); err != nil {
+			return err
+		}
+	}
+	c.thingsLock.Lock()
+	for _, thing := range things {
+		c.wire(thing)
+	}
+	previous := c.things
+	c.things = append(make([]*Thing, 0, len(things)), things...)
+	c.thingsLock.Unlock()
+	kept := make(map[*Thing]bool, len(things))
+	for _, thing := range things {
+		kept[thing] = true
+	}
+	for _, thing := range previous {
+		if !kept[thing] {
+			stopRefreshing(thing)
+		}
+	}
+
+	if !c.IsConnected() {
+		return nil
+	}
+	return c.sendThings()
 }
 
 func (c *Client) PushThings() error {
 	return c.sendThings()
 }
 
-func (c *Client) send(msg proto.Message) error {
-	data, err := proto.Marshal(msg)
+// PushResult describes a thing list sent by PushThingsContext
+type PushResult struct {
+	UpdateLock uint64
+	// Things holds the Ids of the sent things. protocol v1 has no
+	// acknowledgement for thing lists, so they were written to the
+	// connection, there is no way to tell which ones the server accepted.
+	Things []string
+}
+
+// PushThingsContext sends the thing list like PushThings. The write is
+// bounded by the deadline of the context, a context which is done before
+// the write started is returned as error.
+func (c *Client) PushThingsContext(ctx context.Context) (*PushResult, error) {
+	response, err := c.pushThings(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	lenBytes := make([]byte, 4)
-	lenLength := binary.PutUvarint(lenBytes, uint64(len(data)))
-	_, err = c.writer.Write(lenBytes[:lenLength])
-	if err != nil {
+	result := &PushResult{
+		UpdateLock: response.GetUpdateLock(),
+		Things:     make([]string, 0, len(response.GetThings())),
+	}
+	for _, thing := range response.GetThings() {
+		result.Things = append(result.Things, thing.GetId())
+	}
+	return result, nil
+}
+
+func (c *Client) send(msg *protocol.ClientMessage) error {
+	return c.sendContext(context.Background(), msg)
+}
+
+// sendContext sends a message, giving up if the context is done before the
+// write lock was acquired. The deadline of the context bounds the write, a
+// write exceeding it fails and tears down the connection like any failed
+// write.
+func (c *Client) sendContext(ctx context.Context, msg *protocol.ClientMessage) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if err := ctx.Err(); err != nil {
 		return err
 	}
-	n, err := c.writer.Write(data)
+	if c.writer == nil || !c.IsConnected() {
+		return ErrNotConnected
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetWriteDeadline(deadline)
+		defer c.conn.SetWriteDeadline(time.Time{})
+	}
+	data, err := c.marshal(msg)
 	if err != nil {
 		return err
 	}
-	if n != len(data) {
-		return fmt.Errorf("Written only %d bytes instead of %d", n, len(data))
+	if c.tracing && msg.Hello != nil {
+		c.traceHello(data)
+	}
+	if c.maxMessageSize > 0 && len(data) > c.maxMessageSize {
+		return fmt.Errorf("%w: message has %d bytes, the maximum is %d", ErrMessageTooLarge, len(data), c.maxMessageSize)
+	}
+	if err := c.frameCodec().WriteFrame(c.writer, data); err != nil {
+		return c.writeFailed(err)
+	}
+	c.logger.Debug("Message sent", clientMessageFields(msg, len(data))...)
+	c.metrics.Observe(MetricFrameSent, float64(len(data)))
+	return c.flush()
+}
+
+// marshal encodes a message, reusing the preallocated buffer if there is
+// one. The returned data is only valid until the next call. The caller must
+// hold the write lock.
+func (c *Client) marshal(msg *protocol.ClientMessage) ([]byte, error) {
+	if c.marshalBuf == nil {
+		return proto.Marshal(msg)
+	}
+	c.marshalBuf.Reset()
+	if err := c.marshalBuf.Marshal(msg); err != nil {
+		return nil, err
+	}
+	return c.marshalBuf.Bytes(), nil
+}
+
+// flush writes out buffered messages. The caller must hold the write lock.
+func (c *Client) flush() error {
+	if err := c.writer.Flush(); err != nil {
+		return c.writeFailed(err)
+	}
+	return nil
+}
+
+// writeFailed tears down the connection after a failed write, since a
+// partially written frame corrupts the stream for all following messages.
+// Closing the connection ends the read loop, which runs the usual
+// disconnect handling. The caller must hold the write lock.
+func (c *Client) writeFailed(err error) error {
+	c.logger.Error("Error writing to tcp connection", F("error", err))
+	err = &writeError{err: err}
+	c.recordError(err)
+	c.stateLock.Lock()
+	done := c.done
+	c.stateLock.Unlock()
+	c.teardown(done)
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	return err
+}
+
+// BytesRead returns the number of bytes received from the server, including
+// the framing. It counts over the lifetime of the client and is not reset
+// on reconnects.
+func (c *Client) BytesRead() uint64 {
+	return atomic.LoadUint64(&c.bytesRead)
+}
+
+// BytesWritten returns the number of bytes written to the connection,
+// including the framing. Bytes still in the write buffer are not counted. It counts over the lifetime of the client and is not reset
+// on reconnects.
+func (c *Client) BytesWritten() uint64 {
+	return atomic.LoadUint64(&c.bytesWritten)
+}
+
+// PendingWrites returns the number of property changes in the send queue
+// set via WithSendQueue which were not written to the connection yet,
+// including the one being written. Without a send queue every message is
+// written before send returns, so it is always 0.
+func (c *Client) PendingWrites() int {
+	if c.sendQueue == nil {
+		return 0
 	}
-	return c.writer.Flush()
+	return c.sendQueue.unsent()
 }
 
-func (c *Client) read() {
-	//reader := bufio.NewReader(c.conn)
-	messageBuf := bytes.NewBuffer(make([]byte, 0, 4096))
-	lengthBuf := bytes.NewBuffer(make([]byte, 0, 8))
+func (c *Client) read(conn net.Conn, done chan struct{}) {
+	// The buffered reader also guards against connections returning no
+	// data without blocking, after repeated empty reads it fails with
+	// io.ErrNoProgress and the connection is closed
+	reader := bufio.NewReader(countingReader{r: conn, count: &c.bytesRead})
 	for {
-		lengthBytes := make([]byte, 1, 1)
-		readBytes, err := c.conn.Read(lengthBytes)
-		if err != nil {
-			log.Printf("Error reading amount of expected bytes from tcp connection: %v", err)
+		if _, err := reader.Peek(1); err != nil {
+			c.errorLog.log(c.logger.Error, "Error reading amount of expected bytes from tcp connection", F("error", err))
+			c.recordError(err)
 			break
 		}
-		if readBytes == 0 {
-			continue
+		// Once a frame started, the rest of it has to arrive within the
+		// read timeout, otherwise the connection is considered dead
+		if c.readTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+		}
+		messageBuf, err := c.readFrame(reader)
+		if errors.Is(err, ErrMessageTooLarge) {
+			c.errorLog.log(c.logger.Error, "Received frame is too large", F("error", err))
+			c.recordError(err)
+			break
 		}
-		lengthBuf.Write(lengthBytes[:readBytes])
-		expectedLength, err := binary.ReadUvarint(lengthBuf)
 		if err != nil {
-			continue
+			c.errorLog.log(c.logger.Error, "Error reading frame from tcp connection", F("error", err))
+			c.recordError(err)
+			break
 		}
-		lengthBuf.Reset()
-		var receivedBytesTotal uint64
-		receivedBytesTotal = 0
-		for receivedBytesTotal < expectedLength {
-			remainingBytes := expectedLength - receivedBytesTotal
-			dataBuf := make([]byte, remainingBytes, remainingBytes)
-			readBytes, err = c.conn.Read(dataBuf)
-			if err != nil {
-				log.Printf("Error reading message from tcp connection: %v", err)
-				break
-			}
-			// TODO check write to buffer
-			messageBuf.Write(dataBuf[:readBytes])
-			receivedBytesTotal = receivedBytesTotal + uint64(readBytes)
+		receivedAt := time.Now()
+		c.metrics.Observe(MetricFrameReceived, float64(len(messageBuf)))
+		if c.readTimeout > 0 {
+			conn.SetReadDeadline(time.Time{})
 		}
 		serverMessage := protocol.ServerMessage{}
-		err = proto.Unmarshal(messageBuf.Bytes(), &serverMessage)
-		if err != nil {
-			log.Println("Error unmarshalling protobuf message")
+		if err := proto.Unmarshal(messageBuf, &serverMessage); err != nil {
+			c.errorLog.log(c.logger.Error, "Error unmarshalling protobuf message", F("error", err))
 			continue
 		}
-		messageBuf.Reset()
-		c.receiveChan <- serverMessage
+		c.logger.Debug("Message received", serverMessageFields(&serverMessage, len(messageBuf))...)
+		if !c.dispatch(done, receivedMessage{msg: serverMessage, receivedAt: receivedAt}) {
+			break
+		}
+	}
+	conn.Close()
+	c.stateLock.Lock()
+	current := c.done == done
+	c.stateLock.Unlock()
+	c.teardown(done)
+	if !current {
+		// The connection was already replaced by a newer one
+		return
+	}
+	c.logger.Info("Disconnecting from server")
+	if onDisconnect := c.OnDisconnect; onDisconnect != nil {
+		c.runCallback("OnDisconnect", func() { onDisconnect() })
+	}
+	c.stateLock.Lock()
+	reconnect := c.reconnect != nil && !c.closed
+	c.stateLock.Unlock()
+	if reconnect {
+		c.spawn("reconnectLoop", c.reconnectLoop)
+	}
+}
+
+// dispatch hands a received message to the message handler. If the handler
+// doesn't accept it within the dispatch timeout, a warning is logged and
+// it is given a second chance. If it is still stuck after that, the stall
+// is considered fatal and false is returned, so the connection gets closed.
+func (c *Client) dispatch(done chan struct{}, msg receivedMessage) bool {
+	switch c.receivePolicy {
+	case DropOnOverflow:
+		return c.dispatchOrDrop(done, msg)
+	case GrowOnOverflow:
+		return c.dispatchOrQueue(done, msg)
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		select {
+		case c.receiveChan <- msg:
+			return true
+		case <-done:
+			return false
+		case <-time.After(c.dispatchTimeout):
+			c.logger.Error("Message handler did not accept a message in time", F("timeout", c.dispatchTimeout))
+		}
+	}
+	c.logger.Error("Message handler is stalled, closing connection")
+	c.recordError(ErrDispatchStalled)
+	return false
+}
+
+func (c *Client) handleServerMessages(done chan struct{}) {
+	for {
+		if msg, ok := c.nextOverflow(); ok {
+			c.handleServerMessage(msg)
+			continue
+		}
+		select {
+		case msg := <-c.receiveChan:
+			c.handleServerMessage(msg)
+		case <-done:
+			return
+		}
+	}
+}
+
+func (c *Client) handleServerMessage(received receivedMessage) {
+	msg := received.msg
+	if action := msg.GetAction(); action != nil && c.OnActionReceived != nil {
+		c.notifyActionReceived(action)
+	}
+	c.stateLock.Lock()
+	draining := c.draining
+	c.stateLock.Unlock()
+	if draining {
+		if action := msg.GetAction(); action != nil {
+			c.rejectAction(action, reasonDraining)
+		}
+		return
 	}
-	log.Printf("Disconnecting from server")
-	c.conn.Close()
-	c.connected = false
-	if c.OnDisconnect != nil {
-		c.OnDisconnect()
+	if msg.GetHello() != nil {
+		c.handleServerHello(msg.GetHello())
 	}
+	if msg.GetRequestThings() != nil {
+		c.messageHandler(RequestThingsMessage)(&msg, received.receivedAt)
+	}
+	if msg.GetAction() != nil {
+		c.messageHandler(ExecuteMessage)(&msg, received.receivedAt)
+	}
+}
+
+// notifyActionReceived calls OnActionReceived. Parameters exceeding the
+// limits set via WithMaxActionParameters are left out.
+func (c *Client) notifyActionReceived(action *protocol.ServerMessage_Execute) {
+	var path protocol.Path
+	if action.GetPath() != nil {
+		path = *action.GetPath()
+	}
+	var params []string
+	if c.checkParameterLimits(action.GetParameters()) == nil {
+		params = make([]string, 0, len(action.GetParameters()))
+		for _, param := range action.GetParameters() {
+			params = append(params, param.GetValue())
+		}
+	}
+	c.OnActionReceived(path, params, action.GetSequence())
+}
+
+func (c *Client) handleServerHello(hello *protocol.ServerMessage_ServerHello) {
+	if !hello.GetConnected() {
+		err := fmt.Errorf("Server refused connection: %s", hello.GetErrorMsg())
+		c.logger.Error("Server refused connection", F("error", hello.GetErrorMsg()))
+		c.recordError(err)
+		c.notifyServerError(hello.GetErrorMsg())
+	}
+	c.stateLock.Lock()
+	c.serverInfo = ServerInfo{
+		Connected:    hello.GetConnected(),
+		ErrorMessage: hello.GetErrorMsg(),
+		ReceivedAt:   time.Now(),
+	}
+	c.stateLock.Unlock()
+	if hello.GetConnected() {
+		c.resendResults()
+	}
+	c.stateLock.Lock()
+	helloChan := c.helloChan
+	c.stateLock.Unlock()
+	select {
+	case helloChan <- hello:
+	default:
+	}
+}
+
+// traceHello keeps a copy of the serialized hello, the marshal buffer may
+// be reused for the next message
+func (c *Client) traceHello(data []byte) {
+	traced := make([]byte, len(data))
+	copy(traced, data)
+	c.stateLock.Lock()
+	c.tracedHello = traced
+	c.stateLock.Unlock()
 }
 
-func (c *Client) handleServerMessages() {
-	for msg := range c.receiveChan {
-		if msg.GetRequestThings() != nil {
-			c.sendThings()
+func (c *Client) notifyServerError(errorMsg string) {
+	onServerError := c.OnServerError
+	if onServerError == nil {
+		return
+	}
+	c.stateLock.Lock()
+	rejected := c.tracedHello
+	c.stateLock.Unlock()
+	c.runCallback("OnServerError", func() { onServerError(errorMsg, rejected) })
+}
+
+// ServerInfo returns the last hello received from the server
+func (c *Client) ServerInfo() ServerInfo {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	return c.serverInfo
+}
+
+func (c *Client) handleRequestThings() {
+	if c.manualThingPush {
+		if onRequestThings := c.OnRequestThings; onRequestThings != nil {
+			c.runCallback("OnRequestThings", func() { onRequestThings() })
 		}
-		if msg.GetAction() != nil {
-			c.handleAction(msg.GetAction())
+		return
+	}
+	if c.requestThingsDebounce <= 0 {
+		if err := c.answerRequestThings(); err != nil {
+			c.logger.Error("Error sending things", F("error", err))
 		}
+		return
+	}
+	// A response for the current burst is already scheduled
+	c.pushLock.Lock()
+	defer c.pushLock.Unlock()
+	if c.pushPending {
+		return
 	}
+	c.pushPending = true
+	time.AfterFunc(c.requestThingsDebounce, func() {
+		c.pushLock.Lock()
+		c.pushPending = false
+		c.pushLock.Unlock()
+		if err := c.answerRequestThings(); err != nil {
+			c.logger.Error("Error sending things", F("error", err))
+		}
+	})
 }
 
 func (c *Client) getThing(thingId string) *Thing {
+	c.thingsLock.Lock()
+	defer c.thingsLock.Unlock()
+	return c.findThing(thingId)
+}
+
+// findThing returns the abstracted thing with the Id, the caller holds
+// thingsLock
+func (c *Client) findThing(thingId string) *Thing {
 	for _, thing := range c.things {
 		if thingId == thing.Id {
 			return thing
@@ -275,6 +1283,68 @@ func (c *Client) getThing(thingId string) *Thing {
 	return nil
 }
 
+// UpdatePropertyByPath resolves a path of the form
+// thingId/componentId/capabilityId/propertyName and updates the
+// property it points to with the given value
+func (c *Client) UpdatePropertyByPath(path, value string) error {
+	segments := strings.Split(path, "/")
+	if len(segments) != 4 {
+		return fmt.Errorf("Invalid property path %s, expected thingId/componentId/capabilityId/propertyName", path)
+	}
+	property, err := c.lookupProperty(segments)
+	if err != nil {
+		return err
+	}
+	return property.Update(value)
+}
+
+// lookupProperty resolves the segments of a property path under
+// thingsLock, capabilities can change on abstracted things
+func (c *Client) lookupProperty(segments []string) (*Property, error) {
+	c.thingsLock.Lock()
+	defer c.thingsLock.Unlock()
+	thing := c.findThing(segments[0])
+	if thing == nil {
+		return nil, fmt.Errorf("Thing with Id %s not found", segments[0])
+	}
+	component := thing.GetComponent(segments[1])
+	if component == nil {
+		return nil, fmt.Errorf("Component with Id %s not found in thing %s", segments[1], thing.Id)
+	}
+	capability := component.GetCapability(segments[2])
+	if capability == nil {
+		return nil, fmt.Errorf("Capability with Id %s not found in component %s", segments[2], component.Id)
+	}
+	property := capability.GetProperty(segments[3])
+	if property == nil {
+		return nil, fmt.Errorf("Property %s not found in capability %s", segments[3], capability.Id)
+	}
+	return property, nil
+}
+
+// acknowledgeUpdateLock records the update lock of the thing list a
+// RequestThings message refers to, if the server included one
+func (c *Client) acknowledgeUpdateLock(msg *protocol.ServerMessage_RequestThings) {
+	if msg.UpdateLock == nil {
+		return
+	}
+	c.updateLock.Lock()
+	defer c.updateLock.Unlock()
+	if msg.GetUpdateLock() > c.acknowledgedUpdateLock {
+		c.acknowledgedUpdateLock = msg.GetUpdateLock()
+	}
+}
+
+// AcknowledgedUpdateLock returns the highest update lock the server referred
+// to in a RequestThings message, or 0 if it never did. If it is lower than
+// the update lock of the last pushed thing list, that push has not been
+// confirmed yet.
+func (c *Client) AcknowledgedUpdateLock() uint64 {
+	c.updateLock.Lock()
+	defer c.updateLock.Unlock()
+	return c.acknowledgedUpdateLock
+}
+
 func (c *Client) incrementupdateCounter() *uint64 {
 	c.updateLock.Lock()
 	c.updateCounter = c.updateCounter + 1
@@ -284,49 +1354,170 @@ func (c *Client) incrementupdateCounter() *uint64 {
 }
 
 func (c *Client) sendThings() error {
+	_, err := c.pushThings(context.Background())
+	return err
+}
+
+// pushThings sends the thing list under a fresh update lock and returns it
+func (c *Client) pushThings(ctx context.Context) (*protocol.ClientMessage_RequestThingsResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	response := c.thingsResponse(c.incrementupdateCounter())
+	message := &protocol.ClientMessage{
+		RequestThingsResponse: response,
+	}
+	if err := c.sendContext(ctx, message); err != nil {
+		return nil, err
+	}
+	if c.OnThingsPushed != nil {
+		c.OnThingsPushed(response.GetUpdateLock(), len(response.GetThings()))
+	}
+	return response, nil
+}
+
+// thingsResponse builds the thing list, sorted by thing Id
+func (c *Client) thingsResponse(updateLock *uint64) *protocol.ClientMessage_RequestThingsResponse {
+	c.thingsLock.Lock()
 	things := make([]*protocol.Thing, 0, len(c.things))
 	for _, t := range c.things {
 		things = append(things, t.Protocol())
 	}
-
-	response := &protocol.ClientMessage_RequestThingsResponse{
-		UpdateLock: c.incrementupdateCounter(),
+	c.thingsLock.Unlock()
+	sort.SliceStable(things, func(i, j int) bool {
+		return things[i].GetId() < things[j].GetId()
+	})
+	return &protocol.ClientMessage_RequestThingsResponse{
+		UpdateLock: updateLock,
 		Things:     things,
 	}
+}
 
-	message := &protocol.ClientMessage{
-		RequestThingsResponse: response,
+// MarshalThings returns the encoded RequestThingsResponse the client would
+// send next, without sending it. It carries the next update lock, which is
+// not consumed. The encoding is deterministic, so it can be compared with
+// golden files.
+func (c *Client) MarshalThings() ([]byte, error) {
+	c.updateLock.Lock()
+	next := c.updateCounter + 1
+	c.updateLock.Unlock()
+	buf := proto.NewBuffer(nil)
+	buf.SetDeterministic(true)
+	if err := buf.Marshal(c.thingsResponse(&next)); err != nil {
+		return nil, err
 	}
-	return c.send(message)
+	return buf.Bytes(), nil
 }
 
-func (c *Client) handleAction(msg *protocol.ServerMessage_Execute) {
-	// TODO handle action
-	if thing := c.getThing(msg.GetPath().GetThingId()); thing != nil {
-		if component := thing.GetComponent(msg.GetPath().GetComponentId()); component != nil {
-			if action := component.GetAction(msg.GetPath().GetAction()); action != nil {
-				params := make([]string, 0, len(msg.GetParameters()))
-				for _, param := range msg.GetParameters() {
-					params = append(params, *param.Value)
-				}
-				status := protocol.ClientMessage_ExecutionResult_FAILURE
-				var errorMsg string
-				if err := action.Execute(*action, params); err == nil {
-					status = protocol.ClientMessage_ExecutionResult_SUCCESS
-				} else {
-					errorMsg = fmt.Sprintf("%v", err)
-				}
-				result := protocol.ClientMessage_ExecutionResult{
-					ErrorReason: &errorMsg,
-					Result:      &status,
-					Sequence:    msg.Sequence,
-				}
-				message := protocol.ClientMessage{
-					ExecutionResult: &result,
-				}
-				c.send(&message)
-			}
+// lookupAction returns the action addressed by the path and its thing. The
+// action is nil if it doesn't exist. Capabilities can change on abstracted
+// things, so the lookup holds thingsLock.
+func (c *Client) lookupAction(path *protocol.Path) (*Thing, *Action) {
+	c.thingsLock.Lock()
+	defer c.thingsLock.Unlock()
+	thing := c.findThing(path.GetThingId())
+	if thing == nil {
+		return nil, nil
+	}
+	component := thing.GetComponent(path.GetComponentId())
+	if component == nil {
+		return thing, nil
+	}
+	return thing, component.GetAction(path.GetAction())
+}
+
+// handleUnhandledAction answers an Execute message for an action which
+// doesn't exist, with FAILURE unless an UnhandledActionHandler decides
+// otherwise
+func (c *Client) handleUnhandledAction(msg *protocol.ServerMessage_Execute) {
+	var path protocol.Path
+	if msg.GetPath() != nil {
+		path = *msg.GetPath()
+	}
+	var params []string
+	if c.checkParameterLimits(msg.GetParameters()) == nil {
+		params = make([]string, 0, len(msg.GetParameters()))
+		for _, param := range msg.GetParameters() {
+			params = append(params, param.GetValue())
 		}
 	}
+	status := protocol.ClientMessage_ExecutionResult_FAILURE
+	errorMsg := fmt.Sprintf("Unknown action %s of component %s of thing %s",
+		path.GetAction(), path.GetComponentId(), path.GetThingId())
+	if c.unhandledActionHandler != nil {
+		status, errorMsg = c.unhandledActionHandler(path, params)
+	}
+	c.logger.Info("Received unknown action", F("thing", path.GetThingId()),
+		F("component", path.GetComponentId()), F("action", path.GetAction()), F("result", status))
+	c.sendResult(&protocol.ClientMessage_ExecutionResult{
+		ErrorReason: &errorMsg,
+		Result:      &status,
+		Sequence:    msg.Sequence,
+	})
+	c.recordAction(msg, params, status, errorMsg, 0)
+}
 
+func (c *Client) handleAction(msg *protocol.ServerMessage_Execute, receivedAt time.Time) {
+	thing, action := c.lookupAction(msg.GetPath())
+	if action == nil {
+		c.handleUnhandledAction(msg)
+		return
+	}
+	if !c.startAction() {
+		c.rejectAction(msg, reasonDraining)
+		return
+	}
+	defer c.finishAction()
+	cached, duplicate := c.handleDuplicate(msg)
+	if duplicate {
+		return
+	}
+	var params []string
+	status := protocol.ClientMessage_ExecutionResult_FAILURE
+	var errorMsg string
+	var duration time.Duration
+	var err error
+	if action.Execute == nil {
+		// Things assigned after Abstract bypass the validation, so a
+		// missing handler must not panic the dispatch
+		err = fmt.Errorf("Action %s has no handler", action.Name)
+	}
+	if err == nil {
+		err = c.checkParameterLimits(msg.GetParameters())
+	}
+	if err == nil {
+		params = make([]string, 0, len(msg.GetParameters()))
+		for _, param := range msg.GetParameters() {
+			params = append(params, *param.Value)
+		}
+		if c.strictValues {
+			err = validateParameters(action, msg.GetParameters())
+		}
+	}
+	if err == nil {
+		call := *action
+		call.receivedAt = receivedAt
+		start := time.Now()
+		stopWatchdog := c.watchHandler(msg.GetPath())
+		err = c.executeAction(thing, &call, params)
+		stopWatchdog()
+		duration = time.Since(start)
+		c.metrics.Observe(MetricActionDuration, duration.Seconds(), "action:"+action.Name)
+	}
+	if err == nil {
+		status = protocol.ClientMessage_ExecutionResult_SUCCESS
+	} else {
+		errorMsg = errorReason(err)
+	}
+	result := protocol.ClientMessage_ExecutionResult{
+		ErrorReason: &errorMsg,
+		Result:      &status,
+		Sequence:    msg.Sequence,
+	}
+	if cached != nil {
+		c.resultCache.finish(msg.GetSequence(), cached, &result)
+	}
+	c.sendResult(&result)
+	action.recordResult(status, errorMsg)
+	c.recordAction(msg, params, status, errorMsg, duration)
 }
@@ -1,8 +1,21 @@
 package sdk
 
 import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/connctd/sdk-go/testutil"
+	"github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var (
@@ -16,3 +29,1171 @@ func TestValidNameRegexp(t *testing.T) {
 	assert.False(validNameRegexp.MatchString(invalidName1))
 	assert.True(validNameRegexp.MatchString(validName1))
 }
+
+func newTestThing(id string) *Thing {
+	return &Thing{
+		Id:              id,
+		Name:            "Test thing",
+		Manufacturer:    "connctd",
+		MaincomponentId: "main",
+		Components: []*Component{
+			{
+				Id:            "main",
+				Name:          "Main",
+				ComponentType: "sensor",
+				Capabilities: []*Capability{
+					{
+						Id: "temperature",
+						Properties: []*Property{
+							{
+								Name:  "value",
+								Value: &Value{Type: Number, Symbol: "C"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestUpdatePropertyByPathUnknownSegments(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234")
+	assert.Nil(client.Abstract(newTestThing("thing1")))
+
+	assert.Error(client.UpdatePropertyByPath("thing1/main/temperature", "1"))
+	assert.Error(client.UpdatePropertyByPath("thing2/main/temperature/value", "1"))
+	assert.Error(client.UpdatePropertyByPath("thing1/other/temperature/value", "1"))
+	assert.Error(client.UpdatePropertyByPath("thing1/main/humidity/value", "1"))
+	assert.Error(client.UpdatePropertyByPath("thing1/main/temperature/other", "1"))
+}
+
+func TestUpdatePropertyByPath(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := testutil.NewRecorder()
+	client, _ := NewClient("tcp://test", WithDialer(recorder.Dial))
+	thing := newTestThing("thing1")
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+
+	assert.Nil(client.UpdatePropertyByPath("thing1/main/temperature/value", "21.5"))
+	change := recorder.LastPropertyChange()
+	assert.Equal("thing1", change.GetPath().GetThingId())
+	assert.Equal("main", change.GetPath().GetComponentId())
+	assert.Equal("value", change.GetPath().GetProperty())
+	assert.Equal("21.5", change.GetValue().GetValue())
+	assert.Equal("21.5", thing.Components[0].Capabilities[0].Properties[0].Value.Value)
+}
+
+type testServerConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// newTestServer starts a tcp listener and returns its url and a channel
+// delivering every accepted connection
+func newTestServer(t *testing.T) (string, chan *testServerConn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	conns := make(chan *testServerConn, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns <- &testServerConn{Conn: conn, reader: bufio.NewReader(conn)}
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return "tcp://" + listener.Addr().String(), conns
+}
+
+func (s *testServerConn) readClientMessage(t *testing.T) *protocol.ClientMessage {
+	msg, err := s.readMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func (s *testServerConn) writeServerMessage(t *testing.T, msg *protocol.ServerMessage) {
+	if err := s.writeMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readMessage reads the next client message. Unlike readClientMessage it
+// can be used outside the test goroutine.
+func (s *testServerConn) readMessage() (*protocol.ClientMessage, error) {
+	length, err := binary.ReadUvarint(s.reader)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read frame length: %w", err)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, data); err != nil {
+		return nil, fmt.Errorf("Failed to read frame: %w", err)
+	}
+	msg := &protocol.ClientMessage{}
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal client message: %w", err)
+	}
+	return msg, nil
+}
+
+// writeMessage writes a server message. Unlike writeServerMessage it can be
+// used outside the test goroutine.
+func (s *testServerConn) writeMessage(msg *protocol.ServerMessage) error {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal server message: %w", err)
+	}
+	lenBytes := make([]byte, binary.MaxVarintLen64)
+	lenLength := binary.PutUvarint(lenBytes, uint64(len(data)))
+	if _, err := s.Write(append(lenBytes[:lenLength], data...)); err != nil {
+		return fmt.Errorf("Failed to write server message: %w", err)
+	}
+	return nil
+}
+
+func TestRequestThingsDebounce(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url, WithRequestThingsDebounce(50*time.Millisecond))
+	assert.Nil(client.Abstract(newTestThing("thing1")))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+	for i := 0; i < 5; i++ {
+		server.writeServerMessage(t, &protocol.ServerMessage{RequestThings: &protocol.ServerMessage_RequestThings{}})
+	}
+	response := server.readClientMessage(t).GetRequestThingsResponse()
+	assert.NotNil(response)
+	assert.Len(response.GetThings(), 1)
+
+	// No further responses should follow for the same burst
+	server.SetReadDeadline(time.Now().Add(150 * time.Millisecond))
+	_, err := server.reader.ReadByte()
+	assert.Error(err)
+}
+
+func TestPropertyTTLReemitsValue(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url)
+	thing := newTestThing("thing1")
+	property := thing.Components[0].Capabilities[0].Properties[0]
+	property.TTL = 50 * time.Millisecond
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+	assert.Nil(property.Update("21.5"))
+	assert.Equal("21.5", server.readClientMessage(t).GetPropertyChange().GetValue().GetValue())
+	assert.Equal("21.5", server.readClientMessage(t).GetPropertyChange().GetValue().GetValue())
+}
+
+func TestPropertyTTLStopsAfterRemoval(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := testutil.NewRecorder()
+	client, _ := NewClient("tcp://test", WithDialer(recorder.Dial))
+	thing := newTestThing("thing1")
+	property := thing.Components[0].Capabilities[0].Properties[0]
+	property.TTL = 20 * time.Millisecond
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+
+	assert.Nil(property.Update("21.5"))
+	assert.Nil(client.RemoveThing(thing))
+	sent := len(recorder.PropertyChanges())
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(sent, len(recorder.PropertyChanges()))
+
+	other := newTestThing("thing2")
+	property = other.Components[0].Capabilities[0].Properties[0]
+	property.TTL = 20 * time.Millisecond
+	assert.Nil(client.Abstract(other))
+	assert.Nil(property.Update("21.5"))
+	client.Disconnect()
+	property.lock.Lock()
+	assert.Nil(property.refreshTimer)
+	property.lock.Unlock()
+}
+
+func TestManualThingPush(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := testutil.NewRecorder()
+	client, _ := NewClient("tcp://test", WithDialer(recorder.Dial), WithManualThingPush())
+	requested := make(chan struct{}, 1)
+	client.OnRequestThings = func() {
+		requested <- struct{}{}
+	}
+	assert.Nil(client.Abstract(newTestThing("thing1")))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+
+	responses := func() int {
+		count := 0
+		for _, msg := range recorder.Messages() {
+			if msg.GetRequestThingsResponse() != nil {
+				count++
+			}
+		}
+		return count
+	}
+	assert.Nil(recorder.Deliver(&protocol.ServerMessage{RequestThings: &protocol.ServerMessage_RequestThings{}}))
+	select {
+	case <-requested:
+	case <-time.After(time.Second):
+		t.Fatal("OnRequestThings was not called")
+	}
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(0, responses())
+
+	assert.Nil(client.PushThings())
+	assert.Equal(1, responses())
+}
+
+func TestStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url)
+	assert.Nil(client.Abstract(newTestThing("thing1"), newTestThing("thing2")))
+	status := client.Status()
+	assert.False(status.Connected)
+	assert.Equal(2, status.Things)
+	assert.Equal("", status.RemoteAddr)
+	assert.True(status.LastDisconnect.IsZero())
+
+	assert.Nil(client.Connect("unit", "token"))
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+	status = client.Status()
+	assert.True(status.Connected)
+	assert.Equal(2, status.Things)
+	assert.Equal(server.LocalAddr().String(), status.RemoteAddr)
+	assert.Equal(PROTOCOL_VERSION, status.ProtocolVersion)
+
+	client.Disconnect()
+	status = client.Status()
+	assert.False(status.Connected)
+	assert.Equal("", status.RemoteAddr)
+	assert.False(status.LastDisconnect.IsZero())
+	assert.Equal(2, status.Things)
+}
+
+func TestPushThingsNotConnected(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234")
+	thing := newTestThing("thing1")
+	assert.Nil(client.Abstract(thing))
+
+	assert.Equal(ErrNotConnected, client.PushThings())
+	assert.Equal(ErrNotConnected, thing.Components[0].Capabilities[0].Properties[0].Update("1"))
+}
+
+func TestStalledDispatcherClosesConnection(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url, WithDispatchTimeout(20*time.Millisecond))
+	thing := newTestThing("thing1")
+	release := make(chan struct{})
+	defer close(release)
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{
+			Name: "block",
+			Execute: func(action Action, params []string) error {
+				<-release
+				return nil
+			},
+		},
+	}
+	disconnected := make(chan struct{})
+	client.OnDisconnect = func() { close(disconnected) }
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+	thingId, componentId, actionName := "thing1", "main", "block"
+	for i := uint64(0); i < 20; i++ {
+		sequence := i
+		server.writeServerMessage(t, &protocol.ServerMessage{Action: &protocol.ServerMessage_Execute{
+			Sequence: &sequence,
+			Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+		}})
+	}
+
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("Client did not disconnect from stalled dispatcher")
+	}
+	assert.False(client.IsConnected())
+	assert.Equal(ErrDispatchStalled, client.Status().LastError)
+}
+
+func TestValidateKnownTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	strict, _ := NewClient("tcp://localhost:1234", WithKnownTypes([]string{"thermostat"}, []string{"sensor"}, true))
+	thing := newTestThing("thing1")
+	thing.DisplayType = "thermostat"
+	assert.Nil(strict.validateThing(thing))
+
+	thing.DisplayType = "thermostst"
+	assert.Error(strict.validateThing(thing))
+
+	thing.DisplayType = "thermostat"
+	thing.Components[0].ComponentType = "sensr"
+	assert.Error(strict.validateThing(thing))
+
+	lenient, _ := NewClient("tcp://localhost:1234", WithKnownTypes([]string{"thermostat"}, []string{"sensor"}, false))
+	assert.Nil(lenient.validateThing(thing))
+}
+
+func TestStalledFrameClosesConnection(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url, WithReadTimeout(50*time.Millisecond))
+	disconnected := make(chan struct{})
+	client.OnDisconnect = func() { close(disconnected) }
+	assert.Nil(client.Connect("unit", "token"))
+
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+	// Announce 10 bytes but only send 3 of them
+	_, err := server.Write([]byte{10, 1, 2, 3})
+	assert.Nil(err)
+
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("Client did not disconnect on a stalled frame")
+	}
+	assert.False(client.IsConnected())
+}
+
+func TestSetThings(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234")
+	assert.Nil(client.Abstract(newTestThing("thing1"), newTestThing("thing2")))
+
+	assert.Error(client.SetThings(newTestThing("thing3"), newTestThing("thing3")))
+	assert.NotNil(client.getThing("thing1"))
+
+	assert.Nil(client.SetThings(newTestThing("thing3")))
+	assert.Nil(client.getThing("thing1"))
+	assert.NotNil(client.getThing("thing3"))
+	assert.Equal(1, client.Status().Things)
+}
+
+func TestRemoveUnknownThing(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234")
+	assert.Nil(client.Abstract(newTestThing("thing1")))
+	assert.Error(client.RemoveThing(newTestThing("thing2")))
+	assert.NotNil(client.getThing("thing1"))
+}
+
+func TestDisconnectWithDrainWaitsForRunningAction(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url)
+	thing := newTestThing("thing1")
+	started := make(chan struct{})
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{
+			Name: "slow",
+			Execute: func(action Action, params []string) error {
+				close(started)
+				time.Sleep(50 * time.Millisecond)
+				return nil
+			},
+		},
+	}
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+	thingId, componentId, actionName, sequence := "thing1", "main", "slow", uint64(1)
+	server.writeServerMessage(t, &protocol.ServerMessage{Action: &protocol.ServerMessage_Execute{
+		Sequence: &sequence,
+		Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+	}})
+	<-started
+
+	assert.Nil(client.DisconnectWithDrain(time.Second))
+	result := server.readClientMessage(t).GetExecutionResult()
+	assert.Equal(protocol.ClientMessage_ExecutionResult_SUCCESS, result.GetResult())
+}
+
+func TestDisconnectWithDrainRejectsNewActions(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := testutil.NewRecorder()
+	client, _ := NewClient("tcp://test", WithDialer(recorder.Dial))
+	runs := 0
+	thing := newTestThing("thing1")
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{Name: "reset", Execute: func(action Action, params []string) error {
+			runs++
+			return nil
+		}},
+	}
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+
+	// An action still running keeps the drain waiting
+	assert.True(client.startAction())
+	drained := make(chan error)
+	go func() { drained <- client.DisconnectWithDrain(time.Second) }()
+	waitFor(func() bool {
+		client.stateLock.Lock()
+		defer client.stateLock.Unlock()
+		return client.draining
+	})
+
+	thingId, componentId, actionName, sequence := "thing1", "main", "reset", uint64(7)
+	assert.Nil(recorder.Deliver(&protocol.ServerMessage{Action: &protocol.ServerMessage_Execute{
+		Sequence: &sequence,
+		Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+	}}))
+	waitFor(func() bool { return len(recorder.ExecutionResults()) == 1 })
+	result := recorder.ExecutionResults()[0]
+	assert.Equal(uint64(7), result.GetSequence())
+	assert.Equal(protocol.ClientMessage_ExecutionResult_FAILURE, result.GetResult())
+	assert.Equal("Client is disconnecting", result.GetErrorReason())
+	assert.Equal(0, runs)
+
+	client.finishAction()
+	assert.Nil(<-drained)
+}
+
+func TestOnPropertyChanged(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url)
+	changes := make([]string, 0)
+	client.OnPropertyChanged = func(path protocol.Path, old, new string) {
+		changes = append(changes, path.GetThingId()+":"+old+"->"+new)
+	}
+	thing := newTestThing("thing1")
+	property := thing.Components[0].Capabilities[0].Properties[0]
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	<-conns
+
+	assert.Nil(property.Update("1"))
+	assert.Nil(property.Update("1"))
+	assert.Nil(property.Update("2"))
+	assert.Equal([]string{"thing1:->1", "thing1:1->2"}, changes)
+}
+
+func TestUpsertThing(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234")
+	assert.Nil(client.UpsertThing(newTestThing("thing1")))
+	replacement := newTestThing("thing1")
+	replacement.Name = "Replacement"
+	assert.Nil(client.UpsertThing(replacement))
+
+	assert.Equal(1, client.Status().Things)
+	assert.Equal("Replacement", client.getThing("thing1").Name)
+}
+
+func TestAllowNameCollisions(t *testing.T) {
+	assert := assert.New(t)
+
+	thing := newTestThing("thing1")
+	thing.Components[0].Properties = []*Property{
+		{Name: "value", Value: &Value{Type: Number}},
+	}
+
+	client, _ := NewClient("tcp://localhost:1234", WithNameCollisionPolicy(AllowCollisions))
+	assert.Nil(client.Abstract(thing))
+}
+
+func TestRejectPropertyNameSharedByCapabilities(t *testing.T) {
+	assert := assert.New(t)
+
+	thing := newTestThing("thing1")
+	thing.Components[0].Capabilities = append(thing.Components[0].Capabilities, &Capability{
+		Id: "humidity",
+		Properties: []*Property{
+			{Name: "value", Value: &Value{Type: Number, Symbol: "%"}},
+		},
+	})
+
+	client, _ := NewClient("tcp://localhost:1234")
+	assert.Error(client.Abstract(thing))
+	assert.Equal(0, client.Status().Things)
+}
+
+func TestConnectContextWaitsForServerHello(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url)
+	serverErr := make(chan error, 1)
+	go func() {
+		server := <-conns
+		_, err := server.readMessage()
+		if err == nil {
+			connected := true
+			err = server.writeMessage(&protocol.ServerMessage{Hello: &protocol.ServerMessage_ServerHello{Connected: &connected}})
+		}
+		serverErr <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.True(client.ServerInfo().ReceivedAt.IsZero())
+	assert.Nil(client.ConnectContext(ctx, "unit", "token"))
+	assert.Nil(<-serverErr)
+	assert.True(client.IsConnected())
+	info := client.ServerInfo()
+	assert.True(info.Connected)
+	assert.Equal("", info.ErrorMessage)
+	assert.False(info.ReceivedAt.IsZero())
+	client.Disconnect()
+}
+
+func TestRefusedServerHello(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url)
+	serverErr := make(chan error, 1)
+	go func() {
+		server := <-conns
+		_, err := server.readMessage()
+		if err == nil {
+			connected, errorMsg := false, "unknown unit"
+			err = server.writeMessage(&protocol.ServerMessage{
+				Hello: &protocol.ServerMessage_ServerHello{Connected: &connected, ErrorMsg: &errorMsg},
+			})
+		}
+		serverErr <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.EqualError(client.ConnectContext(ctx, "unit", "token"), "Server refused connection: unknown unit")
+	assert.Nil(<-serverErr)
+	assert.False(client.IsConnected())
+	info := client.ServerInfo()
+	assert.False(info.Connected)
+	assert.Equal("unknown unit", info.ErrorMessage)
+}
+
+func TestConnectContextCancelledDuringHandshake(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url)
+	ctx, cancel := context.WithCancel(context.Background())
+	serverErr := make(chan error, 1)
+	go func() {
+		server := <-conns
+		_, err := server.readMessage()
+		// Never answer the hello
+		cancel()
+		serverErr <- err
+	}()
+
+	start := time.Now()
+	assert.Equal(context.Canceled, client.ConnectContext(ctx, "unit", "token"))
+	assert.Nil(<-serverErr)
+	assert.True(time.Since(start) < time.Second)
+	assert.False(client.IsConnected())
+}
+
+func TestSendThingsExceedingMaxMessageSize(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url, WithMaxMessageSize(64))
+	assert.Nil(client.Abstract(newTestThing("thing1"), newTestThing("thing2")))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	<-conns
+
+	err := client.PushThings()
+	assert.True(errors.Is(err, ErrMessageTooLarge))
+	assert.True(client.IsConnected())
+}
+
+func TestValidateMainComponent(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234")
+	thing := newTestThing("thing1")
+	thing.ComponentType = "sensor"
+	assert.Nil(client.validateThing(thing))
+
+	thing.ComponentType = "actor"
+	assert.Error(client.validateThing(thing))
+
+	thing.ComponentType = "sensor"
+	thing.MaincomponentId = "other"
+	assert.Error(client.validateThing(thing))
+}
+
+func TestOnThingsPushed(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url)
+	var pushes []uint64
+	client.OnThingsPushed = func(updateLock uint64, count int) {
+		assert.Equal(2, count)
+		pushes = append(pushes, updateLock)
+	}
+	assert.Nil(client.Abstract(newTestThing("thing1"), newTestThing("thing2")))
+	assert.Equal(ErrNotConnected, client.PushThings())
+	assert.Len(pushes, 0)
+
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	<-conns
+	assert.Nil(client.PushThings())
+	assert.Nil(client.PushThings())
+	assert.Equal([]uint64{2, 3}, pushes)
+}
+
+// failingConn is a net.Conn to the recorder whose writes fail once it was
+// broken
+type failingConn struct {
+	net.Conn
+	broken int32
+	closed int32
+}
+
+func (c *failingConn) Write(b []byte) (int, error) {
+	if atomic.LoadInt32(&c.broken) == 1 {
+		return 0, errors.New("broken pipe")
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *failingConn) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return c.Conn.Close()
+}
+
+// failingDialer dials the recorder and hands out the connection as
+// failingConn
+func failingDialer(recorder *testutil.Recorder, conn *failingConn) Option {
+	return WithDialer(func(ctx context.Context) (net.Conn, error) {
+		recorded, err := recorder.Dial(ctx)
+		conn.Conn = recorded
+		return conn, err
+	})
+}
+
+func TestWriteErrorClosesConnection(t *testing.T) {
+	assert := assert.New(t)
+
+	conn := &failingConn{}
+	client, _ := NewClient("tcp://localhost:1234", failingDialer(testutil.NewRecorder(), conn))
+	thing := newTestThing("thing1")
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	atomic.StoreInt32(&conn.broken, 1)
+	written := client.BytesWritten()
+
+	property := thing.Components[0].Capabilities[0].Properties[0]
+	err := property.Update("1")
+	assert.EqualError(err, "broken pipe")
+	// The buffered change never reached the connection
+	assert.Equal(written, client.BytesWritten())
+	assert.Equal(int32(1), atomic.LoadInt32(&conn.closed))
+	assert.False(client.IsConnected())
+	assert.Equal(err, client.Status().LastError)
+	assert.Equal(ErrNotConnected, property.Update("2"))
+	assert.Equal(ErrNotConnected, client.PushThings())
+}
+
+func TestUserDataReachesSharedActionHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	sites := make([]interface{}, 0)
+	handler := func(action Action, params []string) error {
+		sites = append(sites, action.Client().UserData)
+		return nil
+	}
+	for _, site := range []string{"berlin", "hamburg"} {
+		client, _ := NewClient("tcp://localhost:1234")
+		client.UserData = site
+		thing := newTestThing("thing1")
+		thing.Components[0].Capabilities[0].Actions = []*Action{{Name: "reboot", Execute: handler}}
+		assert.Nil(client.Abstract(thing))
+		assert.Equal(client, thing.Components[0].Capabilities[0].Properties[0].Client())
+
+		thingId, componentId, actionName, sequence := "thing1", "main", "reboot", uint64(1)
+		client.handleAction(&protocol.ServerMessage_Execute{
+			Sequence: &sequence,
+			Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+		}, time.Now())
+	}
+	assert.Equal([]interface{}{"berlin", "hamburg"}, sites)
+}
+
+// emptyConn is a net.Conn whose reads return no data without blocking
+type emptyConn struct {
+	discardConn
+	reads  int32
+	closed int32
+}
+
+func (c *emptyConn) Read(b []byte) (int, error) {
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return 0, io.EOF
+	}
+	atomic.AddInt32(&c.reads, 1)
+	return 0, nil
+}
+
+func (c *emptyConn) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return nil
+}
+
+func TestReadStopsOnEmptyReads(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234", WithLogger(&recordingLogger{}))
+	conn := &emptyConn{}
+	stopped := make(chan struct{})
+	go func() {
+		client.read(conn, make(chan struct{}))
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		conn.Close()
+		t.Fatal("read loop did not stop on a connection without progress")
+	}
+	assert.Equal(io.ErrNoProgress, client.Status().LastError)
+	assert.True(atomic.LoadInt32(&conn.reads) <= 100, "read loop is spinning")
+}
+
+func TestReceiveMultiByteLengthPrefix(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url)
+	thing := newTestThing("thing1")
+	received := make(chan []string, 1)
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{
+			Name: "display",
+			Execute: func(action Action, params []string) error {
+				received <- params
+				return nil
+			},
+		},
+	}
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+
+	// The frame is longer than 127 bytes, so its length prefix takes more
+	// than one byte
+	text := strings.Repeat("x", 300)
+	thingId, componentId, actionName, sequence, paramName := "thing1", "main", "display", uint64(1), "text"
+	server.writeServerMessage(t, &protocol.ServerMessage{Action: &protocol.ServerMessage_Execute{
+		Sequence:   &sequence,
+		Path:       &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+		Parameters: []*protocol.ServerMessage_Execute_Parameter{{Name: &paramName, Value: &text}},
+	}})
+	assert.Equal(protocol.ClientMessage_ExecutionResult_SUCCESS, server.readClientMessage(t).GetExecutionResult().GetResult())
+	assert.Equal([]string{text}, <-received)
+}
+
+func TestAcknowledgedUpdateLock(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234")
+	assert.Equal(uint64(0), client.AcknowledgedUpdateLock())
+	for _, lock := range []uint64{2, 5, 3} {
+		updateLock := lock
+		client.acknowledgeUpdateLock(&protocol.ServerMessage_RequestThings{UpdateLock: &updateLock})
+	}
+	client.acknowledgeUpdateLock(&protocol.ServerMessage_RequestThings{})
+	assert.Equal(uint64(5), client.AcknowledgedUpdateLock())
+}
+
+func TestActionReceivedAt(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url)
+	thing := newTestThing("thing1")
+	latencies := make(chan time.Duration, 1)
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{
+			Name: "reboot",
+			Execute: func(action Action, params []string) error {
+				latencies <- time.Since(action.ReceivedAt())
+				return nil
+			},
+		},
+	}
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+
+	// Actions held back while paused keep their receive time
+	client.Pause()
+	thingId, componentId, actionName, sequence := "thing1", "main", "reboot", uint64(1)
+	server.writeServerMessage(t, &protocol.ServerMessage{Action: &protocol.ServerMessage_Execute{
+		Sequence: &sequence,
+		Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+	}})
+	time.Sleep(50 * time.Millisecond)
+	client.Resume()
+	latency := <-latencies
+	assert.True(latency >= 50*time.Millisecond && latency < time.Minute, "unexpected latency %v", latency)
+	assert.True(client.getThing("thing1").Components[0].Capabilities[0].Actions[0].ReceivedAt().IsZero())
+}
+
+func TestMaxThings(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234", WithMaxThings(2))
+	assert.Nil(client.Abstract(newTestThing("thing1"), newTestThing("thing2")))
+	assert.EqualError(client.Abstract(newTestThing("thing3")), "Too many things: 3 things exceed the maximum of 2")
+	assert.Error(client.UpsertThing(newTestThing("thing3")))
+	assert.Nil(client.UpsertThing(newTestThing("thing2")))
+	assert.Error(client.SetThings(newTestThing("a"), newTestThing("b"), newTestThing("c")))
+	assert.Equal(2, client.Status().Things)
+}
+
+func TestMaxComponentsPerThing(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234", WithMaxComponentsPerThing(1))
+	thing := newTestThing("thing1")
+	assert.Nil(client.Abstract(thing))
+
+	thing = newTestThing("thing2")
+	thing.Components = append(thing.Components, &Component{Id: "second", Name: "Second", ComponentType: "sensor"})
+	assert.EqualError(client.Abstract(thing), "Thing thing2 has 2 components, the maximum is 1")
+}
+
+func TestMarshalThings(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234")
+	assert.Nil(client.Abstract(newTestThing("thing2"), newTestThing("thing1")))
+	data, err := client.MarshalThings()
+	assert.Nil(err)
+	again, err := client.MarshalThings()
+	assert.Nil(err)
+	assert.Equal(data, again)
+
+	response := &protocol.ClientMessage_RequestThingsResponse{}
+	assert.Nil(proto.Unmarshal(data, response))
+	assert.Equal(uint64(1), response.GetUpdateLock())
+	assert.Equal([]string{"thing1", "thing2"}, thingIds(response))
+	assert.Equal(uint64(0), client.updateCounter)
+}
+
+func TestActionNameCollisions(t *testing.T) {
+	assert := assert.New(t)
+
+	ran := make(chan string, 2)
+	toggle := func(capabilityId string) *Action {
+		return &Action{
+			Name: "toggle",
+			Execute: func(action Action, params []string) error {
+				ran <- capabilityId
+				return nil
+			},
+		}
+	}
+	newThing := func() *Thing {
+		thing := newTestThing("thing1")
+		thing.Components[0].Capabilities[0].Actions = []*Action{toggle("temperature")}
+		thing.Components[0].Capabilities = append(thing.Components[0].Capabilities, &Capability{
+			Id:      "light",
+			Actions: []*Action{toggle("light")},
+		})
+		return thing
+	}
+
+	client, _ := NewClient("tcp://localhost:1234")
+	assert.EqualError(client.Abstract(newThing()),
+		"Action toggle of capability light collides with another action in component main")
+
+	// The execute path has no capability, so the first toggle handles it
+	url, conns := newTestServer(t)
+	client, _ = NewClient(url, WithNameCollisionPolicy(AllowCollisions))
+	thing := newThing()
+	thing.Components[0].Actions = []*Action{
+		{
+			Name: "reset",
+			Execute: func(action Action, params []string) error {
+				ran <- "main"
+				return nil
+			},
+		},
+	}
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+
+	thingId, componentId := "thing1", "main"
+	for i, name := range []string{"toggle", "reset"} {
+		actionName, sequence := name, uint64(i)
+		server.writeServerMessage(t, &protocol.ServerMessage{Action: &protocol.ServerMessage_Execute{
+			Sequence: &sequence,
+			Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+		}})
+		assert.Equal(protocol.ClientMessage_ExecutionResult_SUCCESS, server.readClientMessage(t).GetExecutionResult().GetResult())
+	}
+	assert.Equal("temperature", <-ran)
+	assert.Equal("main", <-ran)
+}
+
+func TestComponentLinks(t *testing.T) {
+	assert := assert.New(t)
+
+	newThing := func(link ComponentLink) *Thing {
+		thing := newTestThing("thing1")
+		thing.Components = append(thing.Components, &Component{Id: "heater", Name: "Heater", ComponentType: "actuator"})
+		thing.Components[0].Links = []ComponentLink{link}
+		return thing
+	}
+	thing := newThing(ComponentLink{Relation: "controls", Target: "heater"})
+	assert.Nil(validateLinks(thing))
+	assert.Contains(thing.String(), "relation: controls")
+
+	client, _ := NewClient("tcp://localhost:1234")
+
+	assert.EqualError(client.Abstract(newThing(ComponentLink{Relation: "controls", Target: "boiler"})),
+		"Component main links to the component boiler, which does not exist in thing thing1")
+	assert.EqualError(client.Abstract(newThing(ComponentLink{Relation: "controls", Target: "main"})),
+		"Component main links to itself")
+	assert.EqualError(client.Abstract(newThing(ComponentLink{Relation: "is part of", Target: "heater"})),
+		"is part of is an invalid relation for a link of component main")
+}
+
+func TestOnActionReceived(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234")
+	received := make([]string, 0)
+	client.OnActionReceived = func(path protocol.Path, params []string, sequence uint64) {
+		received = append(received, fmt.Sprintf("%d %s/%s %v", sequence, path.GetThingId(), path.GetAction(), params))
+	}
+	assert.Nil(client.Abstract(newTestThing("thing1")))
+
+	thingId, componentId, actionName, sequence := "thing1", "main", "unknown", uint64(1)
+	value := "on"
+	client.handleServerMessage(receivedMessage{msg: protocol.ServerMessage{Action: &protocol.ServerMessage_Execute{
+		Sequence:   &sequence,
+		Path:       &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+		Parameters: []*protocol.ServerMessage_Execute_Parameter{{Name: &actionName, Value: &value}},
+	}}})
+	assert.Equal([]string{"1 thing1/unknown [on]"}, received)
+}
+
+func TestUnhandledActions(t *testing.T) {
+	assert := assert.New(t)
+
+	thingId, componentId, actionName, sequence := "thing1", "main", "unknown", uint64(1)
+	execute := &protocol.ServerMessage_Execute{
+		Sequence: &sequence,
+		Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+	}
+
+	recorder := testutil.NewRecorder()
+	client, _ := NewClient("tcp://test", WithDialer(recorder.Dial))
+	assert.Nil(client.Abstract(newTestThing("thing1")))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	client.handleAction(execute, time.Now())
+	result := recorder.ExecutionResults()[0]
+	assert.Equal(protocol.ClientMessage_ExecutionResult_FAILURE, result.GetResult())
+	assert.Equal("Unknown action unknown of component main of thing thing1", result.GetErrorReason())
+
+	recorder = testutil.NewRecorder()
+	client, _ = NewClient("tcp://test", WithDialer(recorder.Dial),
+		WithUnhandledActionHandler(func(path protocol.Path, params []string) (protocol.ClientMessage_ExecutionResult_Status, string) {
+			return protocol.ClientMessage_ExecutionResult_SUCCESS, ""
+		}))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	client.handleAction(execute, time.Now())
+	assert.Equal(protocol.ClientMessage_ExecutionResult_SUCCESS, recorder.ExecutionResults()[0].GetResult())
+}
+
+func TestActionWithoutHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := testutil.NewRecorder()
+	client, _ := NewClient("tcp://test", WithDialer(recorder.Dial))
+	thing := newTestThing("thing1")
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{Name: "reset", Execute: func(action Action, params []string) error { return nil }},
+	}
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	thing.Components[0].Capabilities[0].Actions[0].Execute = nil
+
+	thingId, componentId, actionName, sequence := "thing1", "main", "reset", uint64(1)
+	client.handleAction(&protocol.ServerMessage_Execute{
+		Sequence: &sequence,
+		Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+	}, time.Now())
+	result := recorder.ExecutionResults()[0]
+	assert.Equal(protocol.ClientMessage_ExecutionResult_FAILURE, result.GetResult())
+	assert.Equal("Action reset has no handler", result.GetErrorReason())
+	assert.Empty(client.QuarantinedThings())
+}
+
+func TestByteCounters(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url)
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	server := <-conns
+	hello := server.readClientMessage(t)
+	assert.Equal(uint64(proto.Size(hello)+1), client.BytesWritten())
+
+	connected := true
+	msg := &protocol.ServerMessage{Hello: &protocol.ServerMessage_ServerHello{Connected: &connected}}
+	server.writeServerMessage(t, msg)
+	waitFor(func() bool { return client.BytesRead() > 0 })
+	assert.Equal(uint64(proto.Size(msg)+1), client.BytesRead())
+}
+
+func TestPreallocate(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url, WithPreallocate(64*1024))
+	assert.Equal(64*1024, cap(client.marshalBuf.Bytes()))
+	assert.Equal(64*1024+binary.MaxVarintLen64, client.writeBufferSize)
+	assert.Nil(client.Abstract(newTestThing("thing1"), newTestThing("thing2")))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	server := <-conns
+
+	// The reused buffer must not corrupt consecutive messages
+	assert.Equal("unit", server.readClientMessage(t).GetHello().GetUnitId())
+	assert.Nil(client.PushThings())
+	assert.Len(server.readClientMessage(t).GetRequestThingsResponse().GetThings(), 2)
+	assert.Nil(client.getThing("thing1").Push())
+	assert.Equal("thing1", server.readClientMessage(t).GetThing().GetId())
+
+	client, _ = NewClient(url, WithWriteBufferSize(1<<20), WithPreallocate(1024))
+	assert.Equal(1<<20, client.writeBufferSize)
+}
+
+func TestPushThingsContext(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url)
+	assert.Nil(client.Abstract(newTestThing("thing2"), newTestThing("thing1")))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	result, err := client.PushThingsContext(ctx)
+	assert.Nil(err)
+	assert.Equal([]string{"thing1", "thing2"}, result.Things)
+	response := server.readClientMessage(t).GetRequestThingsResponse()
+	assert.Equal(response.GetUpdateLock(), result.UpdateLock)
+
+	cancel()
+	_, err = client.PushThingsContext(ctx)
+	assert.Equal(context.Canceled, err)
+	assert.True(client.IsConnected())
+}
+
+func TestOnServerErrorWithTracing(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url, WithTracing())
+	type serverError struct {
+		errorMsg string
+		rejected []byte
+	}
+	errs := make(chan serverError, 1)
+	client.OnServerError = func(errorMsg string, rejected []byte) {
+		errs <- serverError{errorMsg, rejected}
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		server := <-conns
+		_, err := server.readMessage()
+		if err == nil {
+			connected, errorMsg := false, "invalid token"
+			err = server.writeMessage(&protocol.ServerMessage{
+				Hello: &protocol.ServerMessage_ServerHello{Connected: &connected, ErrorMsg: &errorMsg},
+			})
+		}
+		serverErr <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.EqualError(client.ConnectContext(ctx, "unit", "token"), "Server refused connection: invalid token")
+	assert.Nil(<-serverErr)
+	select {
+	case err := <-errs:
+		assert.Equal("invalid token", err.errorMsg)
+		rejected := &protocol.ClientMessage{}
+		assert.Nil(proto.Unmarshal(err.rejected, rejected))
+		assert.Equal("unit", rejected.GetHello().GetUnitId())
+		assert.Equal("token", rejected.GetHello().GetToken())
+	case <-time.After(time.Second):
+		t.Fatal("OnServerError was not called")
+	}
+}
@@ -0,0 +1,46 @@
+package sdk
+
+import (
+	"fmt"
+	"time"
+)
+
+// DateTimeCodec is a ValueCodec for timestamps, transported as RFC 3339
+// strings in UTC. Offset corrects the clock of devices known to drift, it is
+// added to every encoded timestamp and subtracted from decoded ones, so the
+// platform receives consistent times while the device keeps working with
+// its own clock. Register it like any other custom type:
+//
+//	dateTime, err := RegisterValueType("datetime", DateTimeCodec{Offset: skew})
+type DateTimeCodec struct {
+	Offset time.Duration
+}
+
+func (DateTimeCodec) Primitive() ValueType {
+	return String
+}
+
+// Encode formats a time.Time, applying the offset correction
+func (c DateTimeCodec) Encode(v interface{}) (string, error) {
+	t, ok := v.(time.Time)
+	if !ok {
+		return "", fmt.Errorf("Expected time.Time, got %T", v)
+	}
+	return t.Add(c.Offset).UTC().Format(time.RFC3339Nano), nil
+}
+
+// Decode parses a timestamp into a time.Time, see ParseDateTime
+func (c DateTimeCodec) Decode(s string) (interface{}, error) {
+	return c.ParseDateTime(s)
+}
+
+// ParseDateTime parses a timestamp written by the platform and converts it
+// to the clock of the device by reverting the offset correction. The
+// result is in UTC.
+func (c DateTimeCodec) ParseDateTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is not a RFC 3339 timestamp", s)
+	}
+	return t.Add(-c.Offset).UTC(), nil
+}
@@ -0,0 +1,27 @@
+package sdk
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDateTimeCodec(t *testing.T) {
+	assert := assert.New(t)
+
+	codec := DateTimeCodec{Offset: 90 * time.Second}
+	local := time.Date(2020, 3, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	encoded, err := codec.Encode(local)
+	assert.Nil(err)
+	assert.Equal("2020-03-01T11:01:30Z", encoded)
+
+	decoded, err := codec.ParseDateTime(encoded)
+	assert.Nil(err)
+	assert.True(decoded.Equal(local))
+	assert.Equal(time.UTC, decoded.Location())
+
+	_, err = codec.Decode("yesterday")
+	assert.Error(err)
+	_, err = codec.Encode("2020-03-01")
+	assert.Error(err)
+}
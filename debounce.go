@@ -0,0 +1,88 @@
+package sdk
+
+import (
+	"time"
+)
+
+// debounce holds the debounce state of a property, guarded by the property
+// lock
+type debounce struct {
+	interval time.Duration
+	leading  bool
+	trailing bool
+	// active is set while a burst of updates is going on
+	active bool
+	// timer ends the current burst, generation identifies it to a timer
+	// which fired while it was replaced
+	timer      *time.Timer
+	generation uint64
+	pending    *string
+}
+
+// SetDebounce coalesces bursts of updates. A burst lasts until no update
+// was made for the interval. With leading set, the first update of a burst
+// is sent immediately, which suits sensors like a door contact where the
+// first change matters. With trailing set, the last update of a burst is
+// sent once the burst is over, which suits sensors like a thermometer
+// which should report settled values. With both set, the first and the
+// last value of a burst are sent. Updates deferred or dropped by the
+// debounce return nil, errors sending a trailing value are logged. A zero
+// interval or neither edge set disables debouncing.
+func (p *Property) SetDebounce(interval time.Duration, leading, trailing bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if interval <= 0 || (!leading && !trailing) {
+		p.debounce = nil
+		return
+	}
+	p.debounce = &debounce{interval: interval, leading: leading, trailing: trailing}
+}
+
+// debounced decides whether an update is held back by the debounce. It
+// returns false if the update should be sent right away.
+func (p *Property) debounced(newValue string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	d := p.debounce
+	if d == nil {
+		return false
+	}
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.generation++
+	generation := d.generation
+	d.timer = time.AfterFunc(d.interval, func() {
+		p.endBurst(d, generation)
+	})
+	if !d.active {
+		d.active = true
+		if d.leading {
+			return false
+		}
+	}
+	d.pending = &newValue
+	return true
+}
+
+// endBurst sends the pending value of a burst once no update was made for
+// the debounce interval
+func (p *Property) endBurst(d *debounce, generation uint64) {
+	p.lock.Lock()
+	if d.generation != generation || !d.active {
+		// The burst went on after this timer was started
+		p.lock.Unlock()
+		return
+	}
+	d.active = false
+	d.timer = nil
+	pending := d.pending
+	d.pending = nil
+	p.lock.Unlock()
+	if pending == nil || !d.trailing {
+		return
+	}
+	if err := p.apply(*pending); err != nil && p.client != nil {
+		p.client.logger.Error("Error sending debounced property value", F("property", p.Name), F("error", err))
+	}
+}
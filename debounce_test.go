@@ -0,0 +1,89 @@
+package sdk
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newDebounceTestProperty(t *testing.T) (*Property, *testServerConn, func()) {
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url)
+	thing := newTestThing("thing1")
+	assert.Nil(t, client.Abstract(thing))
+	assert.Nil(t, client.Connect("unit", "token"))
+	server := <-conns
+	assert.NotNil(t, server.readClientMessage(t).GetHello())
+	return thing.Components[0].Capabilities[0].Properties[0], server, func() { client.Disconnect() }
+}
+
+func TestDebounceTrailingEdge(t *testing.T) {
+	assert := assert.New(t)
+
+	property, server, disconnect := newDebounceTestProperty(t)
+	defer disconnect()
+	property.SetDebounce(50*time.Millisecond, false, true)
+
+	for _, value := range []string{"20", "21", "22"} {
+		assert.Nil(property.Update(value))
+	}
+	property.lock.Lock()
+	assert.Equal("", property.Value.Value)
+	property.lock.Unlock()
+	assert.Equal("22", server.readClientMessage(t).GetPropertyChange().GetValue().GetValue())
+}
+
+func TestDebounceLeadingEdge(t *testing.T) {
+	assert := assert.New(t)
+
+	property, server, disconnect := newDebounceTestProperty(t)
+	defer disconnect()
+	property.SetDebounce(50*time.Millisecond, true, false)
+
+	for _, value := range []string{"1", "0", "1", "0"} {
+		assert.Nil(property.Update(value))
+	}
+	assert.Equal("1", server.readClientMessage(t).GetPropertyChange().GetValue().GetValue())
+	time.Sleep(100 * time.Millisecond)
+	property.lock.Lock()
+	assert.Equal("1", property.Value.Value)
+	property.lock.Unlock()
+
+	// The next burst starts with a leading update again
+	assert.Nil(property.Update("0"))
+	assert.Equal("0", server.readClientMessage(t).GetPropertyChange().GetValue().GetValue())
+}
+
+func TestDebounceBothEdges(t *testing.T) {
+	assert := assert.New(t)
+
+	property, server, disconnect := newDebounceTestProperty(t)
+	defer disconnect()
+	property.SetDebounce(50*time.Millisecond, true, true)
+
+	for _, value := range []string{"1", "2", "3"} {
+		assert.Nil(property.Update(value))
+	}
+	assert.Equal("1", server.readClientMessage(t).GetPropertyChange().GetValue().GetValue())
+	assert.Equal("3", server.readClientMessage(t).GetPropertyChange().GetValue().GetValue())
+}
+
+func TestDebounceKeepsOneTimer(t *testing.T) {
+	assert := assert.New(t)
+
+	property, server, disconnect := newDebounceTestProperty(t)
+	defer disconnect()
+	property.SetDebounce(50*time.Millisecond, false, true)
+
+	assert.Nil(property.Update("20"))
+	property.lock.Lock()
+	first := property.debounce.timer
+	property.lock.Unlock()
+	assert.Nil(property.Update("21"))
+	// The replaced timer is stopped instead of firing in vain
+	assert.False(first.Stop())
+	assert.Equal("21", server.readClientMessage(t).GetPropertyChange().GetValue().GetValue())
+	property.lock.Lock()
+	assert.Nil(property.debounce.timer)
+	property.lock.Unlock()
+}
@@ -0,0 +1,140 @@
+package sdk
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrURLParse is returned by Connect if the client url is invalid or
+	// has an unsupported scheme. Retrying won't help.
+	ErrURLParse = errors.New("Invalid server url")
+	// ErrDial is returned by Connect if the server could not be reached,
+	// like on DNS failures or refused connections
+	ErrDial = errors.New("Failed to reach server")
+	// ErrTLSHandshake is returned by Connect if the TLS handshake failed or
+	// the server certificate was not accepted
+	ErrTLSHandshake = errors.New("TLS handshake failed")
+)
+
+// dialError wraps a connection error, so it matches both the kind of error
+// and the underlying error with errors.Is and errors.As
+type dialError struct {
+	kind error
+	err  error
+}
+
+func (e *dialError) Error() string {
+	return fmt.Sprintf("%v: %v", e.kind, e.err)
+}
+
+func (e *dialError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *dialError) Unwrap() error {
+	return e.err
+}
+
+// dial opens the connection to the server described by the client url
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	if c.dialer != nil {
+		return c.dialer(ctx)
+	}
+	connUrl, err := url.Parse(c.host)
+	if err != nil {
+		return nil, &dialError{kind: ErrURLParse, err: err}
+	}
+
+	dialer := &net.Dialer{}
+	switch connUrl.Scheme {
+	case "tcp":
+		conn, err := dialer.DialContext(ctx, "tcp", connUrl.Host)
+		if err != nil {
+			return nil, &dialError{kind: ErrDial, err: err}
+		}
+		return conn, nil
+	case "ssl":
+		conn, err := dialer.DialContext(ctx, "tcp", connUrl.Host)
+		if err != nil {
+			return nil, &dialError{kind: ErrDial, err: err}
+		}
+		tlsConf := &tls.Config{ServerName: connUrl.Hostname()}
+		if c.insecureSkipVerify {
+			c.logger.Error("INSECURE: TLS certificate verification is disabled, never use this in production",
+				F("host", connUrl.Host))
+			tlsConf.InsecureSkipVerify = true
+		}
+		tlsConn := tls.Client(conn, tlsConf)
+		if err := handshake(ctx, tlsConn); err != nil {
+			conn.Close()
+			return nil, &dialError{kind: ErrTLSHandshake, err: err}
+		}
+		if c.pinnedFingerprint != "" {
+			if err := verifyFingerprint(tlsConn, c.pinnedFingerprint); err != nil {
+				conn.Close()
+				return nil, &dialError{kind: ErrTLSHandshake, err: err}
+			}
+		}
+		return tlsConn, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported scheme %s", ErrURLParse, connUrl.Scheme)
+}
+
+// TestConnect checks that the server is reachable by dialing it and, for ssl
+// urls, completing the TLS handshake including certificate pinning. The
+// connection is closed right away without sending the hello, so the unit
+// is not registered and the client state is left untouched. The server
+// sends nothing before the hello, so there is no banner to check.
+func (c *Client) TestConnect(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// handshake performs the TLS handshake, aborting it if the context is done
+func handshake(ctx context.Context, conn *tls.Conn) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- conn.Handshake()
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		// Closing the connection unblocks the handshake
+		conn.Close()
+		<-result
+		return ctx.Err()
+	}
+}
+
+// normalizeFingerprint removes separators and converts a hex fingerprint to
+// lower case, so fingerprints can be given as printed by common tools
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.NewReplacer(":", "", " ", "").Replace(fingerprint))
+}
+
+// verifyFingerprint checks the SHA-256 fingerprint of the leaf certificate
+// presented by the server against the pinned one
+func verifyFingerprint(conn *tls.Conn, pinned string) error {
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return fmt.Errorf("Server presented no certificate")
+	}
+	sum := sha256.Sum256(certs[0].Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+	if fingerprint != normalizeFingerprint(pinned) {
+		return fmt.Errorf("Server certificate fingerprint %s does not match the pinned fingerprint", fingerprint)
+	}
+	return nil
+}
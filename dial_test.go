@@ -0,0 +1,112 @@
+package sdk
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDialInsecureSkipVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	url := "ssl://" + server.Listener.Addr().String()
+
+	client, _ := NewClient(url)
+	_, err := client.dial(context.Background())
+	assert.Error(err)
+
+	recorder := &recordingLogger{}
+	client, _ = NewClient(url, WithInsecureSkipVerify(), WithLogger(recorder))
+	conn, err := client.dial(context.Background())
+	assert.Nil(err)
+	if conn != nil {
+		conn.Close()
+	}
+	assert.Len(recorder.lines, 1)
+	assert.True(strings.HasPrefix(recorder.lines[0], "INSECURE"))
+}
+
+func TestDialPinnedCertFingerprint(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	url := "ssl://" + server.Listener.Addr().String()
+	sum := sha256.Sum256(server.Certificate().Raw)
+	pairs := make([]string, 0, len(sum))
+	for _, b := range sum {
+		pairs = append(pairs, fmt.Sprintf("%02X", b))
+	}
+
+	client, _ := NewClient(url, WithInsecureSkipVerify(), WithLogger(&recordingLogger{}),
+		WithPinnedCertFingerprint(strings.Join(pairs, ":")))
+	conn, err := client.dial(context.Background())
+	assert.Nil(err)
+	if conn != nil {
+		conn.Close()
+	}
+
+	client, _ = NewClient(url, WithInsecureSkipVerify(), WithLogger(&recordingLogger{}),
+		WithPinnedCertFingerprint(strings.Repeat("00", len(sum))))
+	_, err = client.dial(context.Background())
+	assert.Error(err)
+}
+
+func TestDialErrorKinds(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("ftp://localhost:1234")
+	_, err := client.dial(context.Background())
+	assert.True(errors.Is(err, ErrURLParse))
+
+	client, _ = NewClient("%zz")
+	_, err = client.dial(context.Background())
+	assert.True(errors.Is(err, ErrURLParse))
+	var urlErr *url.Error
+	assert.True(errors.As(err, &urlErr))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	addr := listener.Addr().String()
+	listener.Close()
+	client, _ = NewClient("tcp://" + addr)
+	_, err = client.dial(context.Background())
+	assert.True(errors.Is(err, ErrDial))
+	var opErr *net.OpError
+	assert.True(errors.As(err, &opErr))
+
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	client, _ = NewClient("ssl://" + server.Listener.Addr().String())
+	_, err = client.dial(context.Background())
+	assert.True(errors.Is(err, ErrTLSHandshake))
+	assert.False(errors.Is(err, ErrDial))
+}
+
+func TestTestConnect(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url)
+	assert.Nil(client.TestConnect(context.Background()))
+	server := <-conns
+	_, err := server.reader.ReadByte()
+	assert.Equal(io.EOF, err)
+	assert.False(client.IsConnected())
+
+	server2 := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server2.Close()
+	client, _ = NewClient("ssl://" + server2.Listener.Addr().String())
+	assert.True(errors.Is(client.TestConnect(context.Background()), ErrTLSHandshake))
+}
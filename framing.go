@@ -0,0 +1,116 @@
+package sdk
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// FrameCodec splits the byte stream of a connection into the frames
+// carrying the protobuf messages. The default frames each message with a
+// uvarint length prefix. ReadFrame is called with a buffered reader, which
+// also implements io.ByteReader.
+type FrameCodec interface {
+	WriteFrame(w io.Writer, payload []byte) error
+	ReadFrame(r io.Reader) ([]byte, error)
+}
+
+// maxFrameSize caps the frames read even if the maximum message size is
+// disabled, a corrupt length prefix must not allocate arbitrary memory
+const maxFrameSize = 1 << 30
+
+// varintFrameCodec prefixes each frame with its length as uvarint. Frames
+// announcing more than maxSize bytes, or maxFrameSize if maxSize is 0, are
+// rejected before allocating them.
+type varintFrameCodec struct {
+	maxSize int
+}
+
+func (f varintFrameCodec) WriteFrame(w io.Writer, payload []byte) error {
+	lenBytes := make([]byte, binary.MaxVarintLen64)
+	lenLength := binary.PutUvarint(lenBytes, uint64(len(payload)))
+	if _, err := w.Write(lenBytes[:lenLength]); err != nil {
+		return err
+	}
+	n, err := w.Write(payload)
+	if err != nil {
+		return err
+	}
+	if n != len(payload) {
+		return fmt.Errorf("Written only %d bytes instead of %d", n, len(payload))
+	}
+	return nil
+}
+
+func (f varintFrameCodec) ReadFrame(r io.Reader) ([]byte, error) {
+	byteReader, ok := r.(io.ByteReader)
+	if !ok {
+		buffered := bufio.NewReader(r)
+		byteReader, r = buffered, buffered
+	}
+	expectedLength, err := binary.ReadUvarint(byteReader)
+	if err != nil {
+		return nil, err
+	}
+	limit := f.maxSize
+	if limit <= 0 {
+		limit = maxFrameSize
+	}
+	if expectedLength > uint64(limit) {
+		return nil, fmt.Errorf("%w: server announced %d bytes, the maximum is %d",
+			ErrMessageTooLarge, expectedLength, limit)
+	}
+	payload := make([]byte, expectedLength)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// frameCodec returns the codec configured via WithFrameCodec or the default
+func (c *Client) frameCodec() FrameCodec {
+	if c.customFrameCodec != nil {
+		return c.customFrameCodec
+	}
+	return varintFrameCodec{maxSize: c.maxMessageSize}
+}
+
+// readFrame reads the next frame. Custom codecs can't be asked to respect
+// the maximum message size, so their frames are checked once read.
+func (c *Client) readFrame(r io.Reader) ([]byte, error) {
+	payload, err := c.frameCodec().ReadFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	if c.maxMessageSize > 0 && len(payload) > c.maxMessageSize {
+		return nil, fmt.Errorf("%w: server sent %d bytes, the maximum is %d",
+			ErrMessageTooLarge, len(payload), c.maxMessageSize)
+	}
+	return payload, nil
+}
+
+// countingReader counts the bytes read from the connection
+type countingReader struct {
+	r     io.Reader
+	count *uint64
+}
+
+func (r countingReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	atomic.AddUint64(r.count, uint64(n))
+	return n, err
+}
+
+// countingWriter counts the bytes written to the connection
+type countingWriter struct {
+	w     io.Writer
+	count *uint64
+}
+
+func (w countingWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	atomic.AddUint64(w.count, uint64(n))
+	return n, err
+}
@@ -0,0 +1,82 @@
+package sdk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+// fixedFrameCodec prefixes frames with a 4 byte big endian length
+type fixedFrameCodec struct{}
+
+func (fixedFrameCodec) WriteFrame(w io.Writer, payload []byte) error {
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(payload)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+func (fixedFrameCodec) ReadFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header))
+	_, err := io.ReadFull(r, payload)
+	return payload, err
+}
+
+func TestWithFrameCodec(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url, WithFrameCodec(fixedFrameCodec{}))
+	assert.Nil(client.Abstract(newTestThing("thing1")))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	server := <-conns
+
+	codec := fixedFrameCodec{}
+	frame, err := codec.ReadFrame(server.reader)
+	assert.Nil(err)
+	hello := &protocol.ClientMessage{}
+	assert.Nil(proto.Unmarshal(frame, hello))
+	assert.Equal("unit", hello.GetHello().GetUnitId())
+	helloSize := len(frame)
+
+	updateLock := uint64(1)
+	data, err := proto.Marshal(&protocol.ServerMessage{
+		RequestThings: &protocol.ServerMessage_RequestThings{UpdateLock: &updateLock},
+	})
+	assert.Nil(err)
+	assert.Nil(codec.WriteFrame(server, data))
+
+	frame, err = codec.ReadFrame(server.reader)
+	assert.Nil(err)
+	response := &protocol.ClientMessage{}
+	assert.Nil(proto.Unmarshal(frame, response))
+	assert.Len(response.GetRequestThingsResponse().GetThings(), 1)
+	assert.Equal(uint64(4+helloSize+4+len(frame)), client.BytesWritten())
+}
+
+func TestVarintFrameSizeIsCapped(t *testing.T) {
+	assert := assert.New(t)
+
+	lenBytes := make([]byte, binary.MaxVarintLen64)
+	lenLength := binary.PutUvarint(lenBytes, maxFrameSize+1)
+	_, err := varintFrameCodec{}.ReadFrame(bytes.NewReader(lenBytes[:lenLength]))
+	assert.True(errors.Is(err, ErrMessageTooLarge))
+
+	lenLength = binary.PutUvarint(lenBytes, 3)
+	payload, err := varintFrameCodec{}.ReadFrame(bytes.NewReader(append(lenBytes[:lenLength], 1, 2, 3)))
+	assert.Nil(err)
+	assert.Equal([]byte{1, 2, 3}, payload)
+}
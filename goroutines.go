@@ -0,0 +1,45 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// spawn runs f on a new goroutine, which is tracked so leaks can be detected
+func (c *Client) spawn(name string, f func()) {
+	atomic.AddInt64(&c.goroutines, 1)
+	c.metrics.Count(MetricGoroutines, 1, "goroutine:"+name)
+	go func() {
+		defer func() {
+			atomic.AddInt64(&c.goroutines, -1)
+			c.metrics.Count(MetricGoroutines, -1, "goroutine:"+name)
+		}()
+		f()
+	}()
+}
+
+// Goroutines returns the number of internal goroutines currently running,
+// like the read loop of the connection. It drops to zero shortly after
+// Disconnect once running listeners returned, which tests can use to detect
+// goroutine leaks.
+func (c *Client) Goroutines() int {
+	return int(atomic.LoadInt64(&c.goroutines))
+}
+
+// waitForGoroutines waits until all internal goroutines ended or the
+// context is done
+func (c *Client) waitForGoroutines(ctx context.Context) error {
+	for {
+		running := c.Goroutines()
+		if running == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Timed out waiting for %d goroutines to end: %w", running, ctx.Err())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
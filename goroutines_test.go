@@ -0,0 +1,36 @@
+package sdk
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestGoroutinesEndAfterDisconnect(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	metrics := newRecordingMetrics()
+	client, _ := NewClient(url, WithMetrics(metrics), WithMaxConnectionAge(time.Hour), WithSendQueue(4, DropOldest),
+		WithAutoReconnect(3, 10*time.Millisecond, 10*time.Millisecond))
+	client.OnDisconnect = func() {}
+	thing := newTestThing("thing1")
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+	assert.Equal(3, client.Goroutines())
+
+	// Reconnect once, so the goroutines of both connections are covered
+	server.Close()
+	server = <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+	assert.Nil(thing.Components[0].Capabilities[0].Properties[0].Update("1"))
+
+	assert.Nil(client.Disconnect())
+	waitFor(func() bool { return client.Goroutines() == 0 })
+	assert.Equal(0, client.Goroutines())
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	assert.Equal(int64(0), metrics.counts[MetricGoroutines])
+}
@@ -0,0 +1,70 @@
+package sdk
+
+import (
+	"fmt"
+	"github.com/connctd/sdk-go/protocol"
+	"time"
+)
+
+// MessageType identifies a kind of server message which can be given a
+// custom handler via HandleMessageType
+type MessageType byte
+
+const (
+	// RequestThingsMessage is a request for the thing list
+	RequestThingsMessage MessageType = iota
+	// ExecuteMessage is an action invocation
+	ExecuteMessage
+)
+
+// MessageHandler handles a received server message
+type MessageHandler func(msg *protocol.ServerMessage, receivedAt time.Time)
+
+// HandleMessageType replaces the built-in handling of a message type, a nil
+// handler restores it. The server hello can't be overridden, the client
+// needs it to track the connection. Handlers run on the message handling
+// goroutine one message at a time, they are not called while draining.
+func (c *Client) HandleMessageType(typ MessageType, handler MessageHandler) error {
+	if typ != RequestThingsMessage && typ != ExecuteMessage {
+		return fmt.Errorf("Unknown message type %d", typ)
+	}
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	if c.messageHandlers == nil {
+		c.messageHandlers = make(map[MessageType]MessageHandler)
+	}
+	if handler == nil {
+		delete(c.messageHandlers, typ)
+	} else {
+		c.messageHandlers[typ] = handler
+	}
+	return nil
+}
+
+// messageHandler returns the handler registered for the message type or the
+// built-in one
+func (c *Client) messageHandler(typ MessageType) MessageHandler {
+	c.stateLock.Lock()
+	handler := c.messageHandlers[typ]
+	c.stateLock.Unlock()
+	if handler != nil {
+		return handler
+	}
+	switch typ {
+	case RequestThingsMessage:
+		return c.handleRequestThingsMessage
+	default:
+		return c.handleExecuteMessage
+	}
+}
+
+func (c *Client) handleRequestThingsMessage(msg *protocol.ServerMessage, receivedAt time.Time) {
+	c.acknowledgeUpdateLock(msg.GetRequestThings())
+	c.handleRequestThings()
+}
+
+func (c *Client) handleExecuteMessage(msg *protocol.ServerMessage, receivedAt time.Time) {
+	if !c.holdAction(receivedMessage{msg: *msg, receivedAt: receivedAt}) {
+		c.handleAction(msg.GetAction(), receivedAt)
+	}
+}
@@ -0,0 +1,39 @@
+package sdk
+
+import (
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/connctd/sdk-go/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestHandleMessageType(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := testutil.NewRecorder()
+	client, _ := NewClient("tcp://test", WithDialer(recorder.Dial))
+	assert.Nil(client.Abstract(newTestThing("thing1")))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	assert.Error(client.HandleMessageType(MessageType(42), nil))
+
+	handled := make([]uint64, 0)
+	assert.Nil(client.HandleMessageType(RequestThingsMessage, func(msg *protocol.ServerMessage, receivedAt time.Time) {
+		handled = append(handled, msg.GetRequestThings().GetUpdateLock())
+	}))
+	lock := uint64(7)
+	requestThings := receivedMessage{msg: protocol.ServerMessage{
+		RequestThings: &protocol.ServerMessage_RequestThings{UpdateLock: &lock},
+	}}
+	sent := len(recorder.Messages())
+	client.handleServerMessage(requestThings)
+	assert.Equal([]uint64{7}, handled)
+	assert.Len(recorder.Messages(), sent)
+
+	// Removing the handler restores the thing list response
+	assert.Nil(client.HandleMessageType(RequestThingsMessage, nil))
+	client.handleServerMessage(requestThings)
+	waitFor(func() bool { return len(recorder.Messages()) > sent })
+	assert.NotNil(recorder.Messages()[sent].GetRequestThingsResponse())
+}
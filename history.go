@@ -0,0 +1,78 @@
+package sdk
+
+import (
+	"github.com/connctd/sdk-go/protocol"
+	"sync"
+	"time"
+)
+
+// ActionRecord describes a single executed action
+type ActionRecord struct {
+	Path        protocol.Path
+	Parameters  []string
+	Status      protocol.ClientMessage_ExecutionResult_Status
+	ErrorReason string
+	ExecutedAt  time.Time
+	// Duration is the time the action handler took
+	Duration time.Duration
+}
+
+// actionHistory is a ring buffer of the most recently executed actions
+type actionHistory struct {
+	lock    sync.Mutex
+	records []ActionRecord
+	next    int
+	full    bool
+}
+
+func newActionHistory(size int) *actionHistory {
+	return &actionHistory{
+		records: make([]ActionRecord, size),
+	}
+}
+
+func (h *actionHistory) add(record ActionRecord) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.records[h.next] = record
+	h.next = (h.next + 1) % len(h.records)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// list returns the recorded actions, oldest first
+func (h *actionHistory) list() []ActionRecord {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if !h.full {
+		return append([]ActionRecord(nil), h.records[:h.next]...)
+	}
+	records := make([]ActionRecord, 0, len(h.records))
+	records = append(records, h.records[h.next:]...)
+	return append(records, h.records[:h.next]...)
+}
+
+// ActionHistory returns the most recently executed actions, oldest first.
+// It is empty unless enabled via WithActionHistory.
+func (c *Client) ActionHistory() []ActionRecord {
+	if c.actionHistory == nil {
+		return nil
+	}
+	return c.actionHistory.list()
+}
+
+func (c *Client) recordAction(msg *protocol.ServerMessage_Execute, params []string,
+	status protocol.ClientMessage_ExecutionResult_Status, errorReason string, duration time.Duration) {
+	if c.actionHistory == nil {
+		return
+	}
+	c.actionHistory.add(ActionRecord{
+		Path:        *msg.GetPath(),
+		Parameters:  params,
+		Status:      status,
+		ErrorReason: errorReason,
+		ExecutedAt:  time.Now(),
+		Duration:    duration,
+	})
+}
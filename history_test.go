@@ -0,0 +1,21 @@
+package sdk
+
+import (
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestActionHistoryRingBuffer(t *testing.T) {
+	assert := assert.New(t)
+
+	history := newActionHistory(3)
+	assert.Empty(history.list())
+	for _, param := range []string{"1", "2", "3", "4"} {
+		history.add(ActionRecord{Parameters: []string{param}, Status: protocol.ClientMessage_ExecutionResult_SUCCESS})
+	}
+	records := history.list()
+	assert.Len(records, 3)
+	assert.Equal("2", records[0].Parameters[0])
+	assert.Equal("4", records[2].Parameters[0])
+}
@@ -0,0 +1,91 @@
+package sdk
+
+import (
+	"github.com/connctd/sdk-go/protocol"
+	"sync"
+)
+
+// resultCache remembers the results of the most recently handled action
+// sequences of the current connection, so duplicate Execute messages are
+// answered without running the action again. Sequences are only unique per
+// connection, so the cache is reset for every new one.
+type resultCache struct {
+	lock    sync.Mutex
+	results map[uint64]*cachedResult
+	// order holds the cached sequences, oldest first
+	order  []uint64
+	window int
+}
+
+// cachedResult is the result of a sequence, nil while its action runs
+type cachedResult struct {
+	result *protocol.ClientMessage_ExecutionResult
+}
+
+func newResultCache(window int) *resultCache {
+	return &resultCache{
+		results: make(map[uint64]*cachedResult, window),
+		order:   make([]uint64, 0, window),
+		window:  window,
+	}
+}
+
+// begin marks the sequence as being handled. For a sequence seen before it
+// returns true and its result, which is nil while the action still runs.
+// For a new sequence it returns the entry to pass to finish.
+func (r *resultCache) begin(sequence uint64) (*cachedResult, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if cached, ok := r.results[sequence]; ok {
+		return cached, true
+	}
+	if len(r.order) >= r.window {
+		delete(r.results, r.order[0])
+		r.order = r.order[1:]
+	}
+	cached := &cachedResult{}
+	r.results[sequence] = cached
+	r.order = append(r.order, sequence)
+	return cached, false
+}
+
+// finish stores the result of a sequence, unless it already left the window
+// or the cache was reset since begin
+func (r *resultCache) finish(sequence uint64, cached *cachedResult, result *protocol.ClientMessage_ExecutionResult) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.results[sequence] == cached {
+		cached.result = result
+	}
+}
+
+// reset forgets all sequences, a new connection starts its own
+func (r *resultCache) reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.results = make(map[uint64]*cachedResult, r.window)
+	r.order = make([]uint64, 0, r.window)
+}
+
+// handleDuplicate answers an Execute message whose sequence was handled
+// before with the cached result. It returns false for new sequences, which
+// have to be executed, together with the cache entry for their result.
+func (c *Client) handleDuplicate(msg *protocol.ServerMessage_Execute) (*cachedResult, bool) {
+	if c.resultCache == nil {
+		return nil, false
+	}
+	cached, duplicate := c.resultCache.begin(msg.GetSequence())
+	if !duplicate {
+		return cached, false
+	}
+	c.resultCache.lock.Lock()
+	result := cached.result
+	c.resultCache.lock.Unlock()
+	if result == nil {
+		c.logger.Info("Ignoring duplicate of a running action", F("sequence", msg.GetSequence()))
+		return nil, true
+	}
+	c.logger.Info("Resending result of duplicate action", F("sequence", msg.GetSequence()))
+	c.sendResult(result)
+	return nil, true
+}
@@ -0,0 +1,91 @@
+package sdk
+
+import (
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/connctd/sdk-go/testutil"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+)
+
+func TestIdempotentActions(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := testutil.NewRecorder()
+	client, _ := NewClient("tcp://test", WithDialer(recorder.Dial), WithIdempotentActions(2))
+	thing := newTestThing("thing1")
+	runs := int32(0)
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{
+			Name: "dispense",
+			Execute: func(action Action, params []string) error {
+				atomic.AddInt32(&runs, 1)
+				return nil
+			},
+		},
+	}
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+
+	thingId, componentId, actionName := "thing1", "main", "dispense"
+	execute := func(sequence uint64) {
+		results := len(recorder.ExecutionResults())
+		assert.Nil(recorder.Deliver(&protocol.ServerMessage{Action: &protocol.ServerMessage_Execute{
+			Sequence: &sequence,
+			Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+		}}))
+		waitFor(func() bool { return len(recorder.ExecutionResults()) > results })
+	}
+	execute(1)
+	execute(1)
+	assert.Equal(int32(1), atomic.LoadInt32(&runs))
+	results := recorder.ExecutionResults()
+	assert.Len(results, 2)
+	assert.Equal(results[0], results[1])
+
+	// Sequence 1 leaves the window of two
+	execute(2)
+	execute(3)
+	execute(1)
+	assert.Equal(int32(4), atomic.LoadInt32(&runs))
+
+	// Sequences start over on a new connection
+	client.Disconnect()
+	assert.Nil(client.Connect("unit", "token"))
+	execute(3)
+	assert.Equal(int32(5), atomic.LoadInt32(&runs))
+}
+
+func TestResultCacheIgnoresRunningDuplicates(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := newResultCache(4)
+	entry, duplicate := cache.begin(7)
+	assert.False(duplicate)
+	cached, duplicate := cache.begin(7)
+	assert.True(duplicate)
+	assert.Nil(cached.result)
+
+	status := protocol.ClientMessage_ExecutionResult_SUCCESS
+	cache.finish(7, entry, &protocol.ClientMessage_ExecutionResult{Result: &status})
+	cached, duplicate = cache.begin(7)
+	assert.True(duplicate)
+	assert.Equal(status, cached.result.GetResult())
+}
+
+func TestResultCacheReset(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := newResultCache(4)
+	previous, _ := cache.begin(7)
+	cache.reset()
+	entry, duplicate := cache.begin(7)
+	assert.False(duplicate)
+
+	// An action of the previous connection finishing late doesn't answer
+	// the new sequence
+	status := protocol.ClientMessage_ExecutionResult_FAILURE
+	cache.finish(7, previous, &protocol.ClientMessage_ExecutionResult{Result: &status})
+	assert.Nil(entry.result)
+}
@@ -0,0 +1,103 @@
+package sdk
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// thingIsolation tracks consecutive action failures per thing and
+// quarantines things which fail too often, so a single misbehaving device
+// doesn't affect the others served over the same connection
+type thingIsolation struct {
+	lock        sync.Mutex
+	threshold   int
+	failures    map[string]int
+	quarantined map[string]bool
+}
+
+func newThingIsolation(threshold int) *thingIsolation {
+	return &thingIsolation{
+		threshold:   threshold,
+		failures:    make(map[string]int),
+		quarantined: make(map[string]bool),
+	}
+}
+
+func (i *thingIsolation) isQuarantined(thingId string) bool {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.quarantined[thingId]
+}
+
+// track records the outcome of an action and returns true if the thing
+// got quarantined because of it
+func (i *thingIsolation) track(thingId string, err error) bool {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if err == nil {
+		delete(i.failures, thingId)
+		return false
+	}
+	i.failures[thingId]++
+	if i.threshold > 0 && i.failures[thingId] >= i.threshold {
+		i.quarantined[thingId] = true
+		delete(i.failures, thingId)
+		return true
+	}
+	return false
+}
+
+func (i *thingIsolation) release(thingId string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	delete(i.quarantined, thingId)
+	delete(i.failures, thingId)
+}
+
+func (i *thingIsolation) list() []string {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	ids := make([]string, 0, len(i.quarantined))
+	for id := range i.quarantined {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// executeAction runs the handler of an action of the given thing. Panics
+// are recovered and reported as error. Actions of quarantined things are
+// not executed at all.
+func (c *Client) executeAction(thing *Thing, action *Action, params []string) error {
+	if c.isolation.isQuarantined(thing.Id) {
+		return fmt.Errorf("Thing %s is quarantined", thing.Id)
+	}
+	err := c.safeExecute(thing, action, params)
+	if c.isolation.track(thing.Id, err) {
+		c.logger.Error("Thing quarantined after consecutive failed actions",
+			F("thing", thing.Id), F("failures", c.isolation.threshold))
+	}
+	return err
+}
+
+func (c *Client) safeExecute(thing *Thing, action *Action, params []string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.logger.Error("Action panicked", F("thing", thing.Id), F("action", action.Name), F("panic", r))
+			err = fmt.Errorf("Action %s panicked: %v", action.Name, r)
+		}
+	}()
+	return action.Execute(*action, params)
+}
+
+// QuarantinedThings returns the Ids of all things whose actions are no
+// longer executed because they failed repeatedly
+func (c *Client) QuarantinedThings() []string {
+	return c.isolation.list()
+}
+
+// ReleaseThing lifts the quarantine of a thing
+func (c *Client) ReleaseThing(thingId string) {
+	c.isolation.release(thingId)
+}
@@ -0,0 +1,40 @@
+package sdk
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExecuteActionQuarantinesFailingThing(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234", WithQuarantineThreshold(2))
+	faulty := newTestThing("faulty")
+	healthy := newTestThing("healthy")
+	calls := 0
+	panicking := &Action{Name: "reboot", Execute: func(action Action, params []string) error {
+		calls++
+		panic("device gone")
+	}}
+	working := &Action{Name: "reboot", Execute: func(action Action, params []string) error {
+		return nil
+	}}
+
+	assert.Error(client.executeAction(faulty, panicking, nil))
+	assert.Nil(client.executeAction(healthy, working, nil))
+	assert.Error(client.executeAction(faulty, panicking, nil))
+	assert.Equal([]string{"faulty"}, client.QuarantinedThings())
+
+	assert.Error(client.executeAction(faulty, panicking, nil))
+	assert.Equal(2, calls)
+	assert.Nil(client.executeAction(healthy, working, nil))
+
+	client.ReleaseThing("faulty")
+	assert.Empty(client.QuarantinedThings())
+	failing := &Action{Name: "reboot", Execute: func(action Action, params []string) error {
+		return errors.New("failed")
+	}}
+	assert.Error(client.executeAction(faulty, failing, nil))
+	assert.Empty(client.QuarantinedThings())
+}
@@ -0,0 +1,172 @@
+package sdk
+
+import (
+	"fmt"
+	"github.com/connctd/sdk-go/protocol"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger is implemented by plain loggers like the ones of the log package
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Field is a key value pair attached to a log message
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F creates a log Field
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// StructuredLogger receives log messages together with key value context,
+// so they can be queried in a log aggregation system
+type StructuredLogger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+}
+
+type printfLogger struct {
+	logger Logger
+	debug  bool
+}
+
+// NewPrintfLogger adapts a plain Printf logger to a StructuredLogger. Fields
+// are appended to the message as key=value pairs. Debug messages, like the
+// ones for every sent and received message, are only logged if debug is
+// set.
+func NewPrintfLogger(logger Logger, debug bool) StructuredLogger {
+	return &printfLogger{logger: logger, debug: debug}
+}
+
+func (l *printfLogger) Debug(msg string, fields ...Field) {
+	if l.debug {
+		l.log(msg, fields)
+	}
+}
+
+func (l *printfLogger) Info(msg string, fields ...Field) {
+	l.log(msg, fields)
+}
+
+func (l *printfLogger) Error(msg string, fields ...Field) {
+	l.log(msg, fields)
+}
+
+func (l *printfLogger) log(msg string, fields []Field) {
+	if len(fields) == 0 {
+		l.logger.Printf("%s", msg)
+		return
+	}
+	pairs := make([]string, 0, len(fields))
+	for _, field := range fields {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", field.Key, field.Value))
+	}
+	l.logger.Printf("%s %s", msg, strings.Join(pairs, " "))
+}
+
+// stdLogger logs via the standard logger of the log package
+type stdLogger struct{}
+
+func (stdLogger) Printf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+// logThrottle suppresses log messages repeated with the same error within
+// an interval, so a flapping connection doesn't flood the log. Messages are
+// told apart by their text and error field only, so e.g. reconnect attempts
+// failing the same way are throttled although their attempt counts differ.
+// The number of suppressed repetitions is attached once the message is
+// logged again.
+type logThrottle struct {
+	interval time.Duration
+	lock     *sync.Mutex
+	seen     map[string]*throttledMessage
+}
+
+type throttledMessage struct {
+	lastLogged time.Time
+	suppressed int
+}
+
+func newLogThrottle(interval time.Duration) *logThrottle {
+	return &logThrottle{interval: interval, lock: &sync.Mutex{}, seen: make(map[string]*throttledMessage)}
+}
+
+func (t *logThrottle) log(log func(msg string, fields ...Field), msg string, fields ...Field) {
+	key := throttleKey(msg, fields)
+	now := time.Now()
+	t.lock.Lock()
+	seen, ok := t.seen[key]
+	if ok && now.Sub(seen.lastLogged) < t.interval {
+		seen.suppressed++
+		t.lock.Unlock()
+		return
+	}
+	if ok && seen.suppressed > 0 {
+		fields = append(fields, F("repeated", seen.suppressed))
+	}
+	for other, message := range t.seen {
+		// Forget messages which stopped repeating
+		if message.suppressed == 0 && now.Sub(message.lastLogged) >= t.interval {
+			delete(t.seen, other)
+		}
+	}
+	t.seen[key] = &throttledMessage{lastLogged: now}
+	t.lock.Unlock()
+	log(msg, fields...)
+}
+
+func throttleKey(msg string, fields []Field) string {
+	key := msg
+	for _, field := range fields {
+		if field.Key == "error" {
+			key += fmt.Sprint(" ", field.Value)
+		}
+	}
+	return key
+}
+
+// clientMessageFields describes a client message for logging
+func clientMessageFields(msg *protocol.ClientMessage, size int) []Field {
+	fields := []Field{F("size", size)}
+	switch {
+	case msg.GetHello() != nil:
+		fields = append(fields, F("type", "hello"))
+	case msg.GetThing() != nil:
+		fields = append(fields, F("type", "thing"), F("thing", msg.GetThing().GetId()))
+	case msg.GetRequestThingsResponse() != nil:
+		fields = append(fields, F("type", "requestThingsResponse"),
+			F("updateLock", msg.GetRequestThingsResponse().GetUpdateLock()))
+	case msg.GetPropertyChange() != nil:
+		fields = append(fields, F("type", "propertyChange"),
+			F("thing", msg.GetPropertyChange().GetPath().GetThingId()))
+	case msg.GetExecutionResult() != nil:
+		fields = append(fields, F("type", "executionResult"),
+			F("sequence", msg.GetExecutionResult().GetSequence()))
+	}
+	return fields
+}
+
+// serverMessageFields describes a server message for logging
+func serverMessageFields(msg *protocol.ServerMessage, size int) []Field {
+	fields := []Field{F("size", size)}
+	switch {
+	case msg.GetHello() != nil:
+		fields = append(fields, F("type", "hello"))
+	case msg.GetRequestThings() != nil:
+		fields = append(fields, F("type", "requestThings"))
+	case msg.GetAction() != nil:
+		fields = append(fields, F("type", "action"),
+			F("thing", msg.GetAction().GetPath().GetThingId()),
+			F("sequence", msg.GetAction().GetSequence()))
+	}
+	return fields
+}
@@ -0,0 +1,72 @@
+package sdk
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestPrintfLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := &recordingLogger{}
+	logger := NewPrintfLogger(recorder, false)
+	logger.Debug("Message sent", F("size", 12))
+	logger.Info("Disconnecting from server")
+	logger.Error("Action panicked", F("thing", "thing1"), F("action", "reboot"))
+	assert.Equal([]string{
+		"Disconnecting from server",
+		"Action panicked thing=thing1 action=reboot",
+	}, recorder.lines)
+
+	NewPrintfLogger(recorder, true).Debug("Message sent", F("size", 12))
+	assert.Equal("Message sent size=12", recorder.lines[2])
+}
+
+func TestLogThrottle(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := &recordingLogger{}
+	logger := NewPrintfLogger(recorder, false)
+	throttle := newLogThrottle(time.Hour)
+	for i := 0; i < 5; i++ {
+		throttle.log(logger.Error, "Read failed", F("error", "timeout"))
+	}
+	throttle.log(logger.Error, "Read failed", F("error", "reset"))
+	assert.Equal([]string{
+		"Read failed error=timeout",
+		"Read failed error=reset",
+	}, recorder.lines)
+
+	throttle = newLogThrottle(0)
+	throttle.log(logger.Error, "Read failed")
+	throttle.seen["Read failed"].suppressed = 3
+	throttle.log(logger.Error, "Read failed")
+	assert.Equal("Read failed repeated=3", recorder.lines[3])
+}
+
+func TestLogThrottleInterleaved(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := &recordingLogger{}
+	logger := NewPrintfLogger(recorder, false)
+	throttle := newLogThrottle(time.Hour)
+	for attempt := 1; attempt <= 3; attempt++ {
+		throttle.log(logger.Error, "Read failed", F("error", "reset"))
+		throttle.log(logger.Error, "Reconnect attempt failed", F("attempt", attempt), F("error", "refused"))
+	}
+	assert.Equal([]string{
+		"Read failed error=reset",
+		"Reconnect attempt failed attempt=1 error=refused",
+	}, recorder.lines)
+	assert.Equal(2, throttle.seen["Reconnect attempt failed refused"].suppressed)
+}
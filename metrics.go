@@ -0,0 +1,32 @@
+package sdk
+
+// Metrics receives measurements of the client, so they can be exported to a
+// monitoring system. Tags are passed as "key:value" strings.
+type Metrics interface {
+	// Count adds delta to the counter with the given name
+	Count(name string, delta int64, tags ...string)
+	// Observe records a single measurement, like a duration, of the
+	// histogram with the given name
+	Observe(name string, value float64, tags ...string)
+}
+
+const (
+	// MetricActionDuration is the execution time of action handlers in
+	// seconds, tagged with the action name
+	MetricActionDuration = "action.duration"
+	// MetricFrameReceived is the payload length in bytes of each frame read
+	// from the server, without the length prefix
+	MetricFrameReceived = "frame.received.bytes"
+	// MetricFrameSent is the payload length in bytes of each frame written
+	// to the server, without the length prefix
+	MetricFrameSent = "frame.sent.bytes"
+	// MetricGoroutines counts the running internal goroutines of the client,
+	// tagged with the goroutine name. It is incremented when a goroutine
+	// starts and decremented when it ends.
+	MetricGoroutines = "client.goroutines"
+)
+
+type noopMetrics struct{}
+
+func (noopMetrics) Count(name string, delta int64, tags ...string)     {}
+func (noopMetrics) Observe(name string, value float64, tags ...string) {}
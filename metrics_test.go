@@ -0,0 +1,99 @@
+package sdk
+
+import (
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+type observation struct {
+	name  string
+	value float64
+	tags  []string
+}
+
+// recordingMetrics keeps all reported measurements
+type recordingMetrics struct {
+	lock         sync.Mutex
+	counts       map[string]int64
+	observations []observation
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{counts: make(map[string]int64)}
+}
+
+func (m *recordingMetrics) Count(name string, delta int64, tags ...string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.counts[name] += delta
+}
+
+func (m *recordingMetrics) Observe(name string, value float64, tags ...string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.observations = append(m.observations, observation{name: name, value: value, tags: tags})
+}
+
+func TestActionDurationMetric(t *testing.T) {
+	assert := assert.New(t)
+
+	metrics := newRecordingMetrics()
+	client, _ := NewClient("tcp://localhost:1234", WithMetrics(metrics), WithActionHistory(5))
+	thing := newTestThing("thing1")
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{
+			Name: "calibrate",
+			Execute: func(action Action, params []string) error {
+				time.Sleep(20 * time.Millisecond)
+				return nil
+			},
+		},
+	}
+	assert.Nil(client.Abstract(thing))
+	thingId, componentId, actionName, sequence := "thing1", "main", "calibrate", uint64(1)
+	client.handleAction(&protocol.ServerMessage_Execute{
+		Sequence: &sequence,
+		Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+	}, time.Now())
+
+	assert.Len(metrics.observations, 1)
+	assert.Equal(MetricActionDuration, metrics.observations[0].name)
+	assert.Equal([]string{"action:calibrate"}, metrics.observations[0].tags)
+	assert.True(metrics.observations[0].value >= 0.02)
+	assert.True(client.ActionHistory()[0].Duration >= 20*time.Millisecond)
+}
+
+func TestFrameSizeMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	metrics := newRecordingMetrics()
+	client, _ := NewClient(url, WithMetrics(metrics))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+
+	connected := true
+	msg := &protocol.ServerMessage{Hello: &protocol.ServerMessage_ServerHello{Connected: &connected}}
+	server.writeServerMessage(t, msg)
+	waitFor(func() bool {
+		metrics.lock.Lock()
+		defer metrics.lock.Unlock()
+		return len(metrics.observations) == 2
+	})
+
+	hello := &protocol.ClientMessage{Hello: &protocol.ClientMessage_ClientHello{
+		UnitId: proto.String("unit"), Token: proto.String("token"), ProtocolVersion: &PROTOCOL_VERSION,
+	}}
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	assert.Equal([]observation{
+		{name: MetricFrameSent, value: float64(proto.Size(hello))},
+		{name: MetricFrameReceived, value: float64(proto.Size(msg))},
+	}, metrics.observations)
+}
@@ -0,0 +1,392 @@
+package sdk
+
+import (
+	"context"
+	"github.com/connctd/sdk-go/protocol"
+	"net"
+	"time"
+)
+
+// Option configures optional behaviour of a Client
+type Option func(c *Client)
+
+// CollisionPolicy decides how names occurring more than once within a
+// component are treated
+type CollisionPolicy byte
+
+const (
+	// RejectCollisions rejects things with colliding names, this is the
+	// default
+	RejectCollisions CollisionPolicy = iota
+	// AllowCollisions accepts colliding names. Updates of such properties
+	// can not be distinguished by the server and executions of such actions
+	// are handled by the first action found.
+	AllowCollisions
+)
+
+// WithRequestThingsDebounce coalesces RequestThings messages received within
+// the given window into a single response. The response is sent once the
+// window after the first request of a burst has passed, so every burst is
+// answered at least once.
+func WithRequestThingsDebounce(window time.Duration) Option {
+	return func(c *Client) {
+		c.requestThingsDebounce = window
+	}
+}
+
+// WithNumberFormat configures how numeric property values are formatted by
+// Property.UpdateNumber and normalized by Property.Update
+func WithNumberFormat(format NumberFormat) Option {
+	return func(c *Client) {
+		c.numberFormat = format
+	}
+}
+
+// WithDispatchTimeout sets how long the connection reader waits for the
+// message handler to accept a received message. If the handler is stuck
+// for twice this duration the connection is closed.
+func WithDispatchTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.dispatchTimeout = timeout
+	}
+}
+
+// WithKnownTypes validates the display types and component types of
+// abstracted things against the given sets. A nil set disables the
+// respective check. Unknown types are rejected if strict is set and only
+// logged otherwise.
+func WithKnownTypes(displayTypes, componentTypes []string, strict bool) Option {
+	return func(c *Client) {
+		if displayTypes != nil {
+			c.knownDisplayTypes = make(map[string]bool, len(displayTypes))
+			for _, displayType := range displayTypes {
+				c.knownDisplayTypes[displayType] = true
+			}
+		}
+		if componentTypes != nil {
+			c.knownComponentTypes = make(map[string]bool, len(componentTypes))
+			for _, componentType := range componentTypes {
+				c.knownComponentTypes[componentType] = true
+			}
+		}
+		c.strictTypes = strict
+	}
+}
+
+// WithReadTimeout sets the time a frame has to be received in completely
+// once its first byte arrived. A server stalling in the middle of a frame
+// causes the connection to be closed. Idle connections are not affected.
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.readTimeout = timeout
+	}
+}
+
+// WithActionHistory keeps the last size executed actions, which can be
+// retrieved via Client.ActionHistory. A size of 0 disables the history.
+func WithActionHistory(size int) Option {
+	return func(c *Client) {
+		c.actionHistory = nil
+		if size > 0 {
+			c.actionHistory = newActionHistory(size)
+		}
+	}
+}
+
+// WithManualThingPush disables answering RequestThings messages
+// automatically. Instead OnRequestThings is called and the application has
+// to call PushThings once it is ready. WithRequestThingsDebounce has no
+// effect then and a provider set via WithThingProvider is not asked for
+// the things, PushThings sends the abstracted things.
+func WithManualThingPush() Option {
+	return func(c *Client) {
+		c.manualThingPush = true
+	}
+}
+
+// WithQuarantineThreshold quarantines a thing after the given number of
+// consecutive failed or panicking actions. Actions of quarantined things are
+// answered with a failure without being executed until the thing is
+// released via Client.ReleaseThing. A threshold of 0 disables quarantining.
+func WithQuarantineThreshold(threshold int) Option {
+	return func(c *Client) {
+		c.isolation = newThingIsolation(threshold)
+	}
+}
+
+// WithNameCollisionPolicy configures how property and action names occurring
+// in more than one capability of a component are treated
+func WithNameCollisionPolicy(policy CollisionPolicy) Option {
+	return func(c *Client) {
+		c.collisionPolicy = policy
+	}
+}
+
+// WithAutoReconnect reconnects automatically when the connection is lost
+// unexpectedly. The delay between attempts starts at minDelay and doubles
+// after every failed attempt up to maxDelay. After maxAttempts failed
+// attempts reconnecting is given up, 0 retries forever.
+func WithAutoReconnect(maxAttempts int, minDelay, maxDelay time.Duration) Option {
+	return func(c *Client) {
+		c.reconnect = &reconnectConfig{
+			maxAttempts: maxAttempts,
+			minDelay:    minDelay,
+			maxDelay:    maxDelay,
+		}
+	}
+}
+
+// WithLogger logs via a plain Printf logger, like a *log.Logger
+func WithLogger(logger Logger) Option {
+	return func(c *Client) {
+		c.logger = NewPrintfLogger(logger, false)
+	}
+}
+
+// WithStructuredLogger logs via a logger accepting key value fields
+func WithStructuredLogger(logger StructuredLogger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithMaxMessageSize limits the size of sent and received messages. Sending
+// a larger message fails with ErrMessageTooLarge, receiving one closes the
+// connection. Protocol version 1 can not split the thing list, so a thing
+// list exceeding the limit can not be pushed. 0 disables the limit, except
+// for received frames which are still capped at 1 GiB. The default is
+// 16 MiB.
+func WithMaxMessageSize(size int) Option {
+	return func(c *Client) {
+		c.maxMessageSize = size
+	}
+}
+
+// WithWriteBufferSize sets the size of the buffer messages are written to
+// before being flushed to the connection, the default is 4096 bytes. A
+// buffer larger than the typical message, e.g. a large thing list, needs
+// fewer writes to the socket, but keeps more memory per connection.
+func WithWriteBufferSize(size int) Option {
+	return func(c *Client) {
+		c.writeBufferSize = size
+	}
+}
+
+// WithPreallocate sizes the buffers used to marshal and write messages for
+// a thing list of thingListBytes when the client is created, so pushing a
+// large thing list right after connecting doesn't have to grow them. The
+// write buffer is only enlarged, never shrunk below WithWriteBufferSize.
+func WithPreallocate(thingListBytes int) Option {
+	return func(c *Client) {
+		c.preallocate = thingListBytes
+	}
+}
+
+// WithPauseMode sets whether actions received while the client is paused
+// are queued until Resume or rejected, see Client.Pause
+func WithPauseMode(mode PauseMode) Option {
+	return func(c *Client) {
+		c.pauseMode = mode
+	}
+}
+
+// WithInsecureSkipVerify disables the verification of the server
+// certificate for ssl connections.
+//
+// WARNING: This makes the connection vulnerable to man-in-the-middle
+// attacks. It only exists for development against servers with self-signed
+// certificates and must never be used in production. A warning is logged on
+// every connect while it is enabled.
+func WithInsecureSkipVerify() Option {
+	return func(c *Client) {
+		c.insecureSkipVerify = true
+	}
+}
+
+// WithThingProvider asks the provider for the current things whenever the
+// server requests the thing list. The provided things replace the ones
+// returned by the previous call, things added via Abstract are kept. If the
+// provider fails, the previous list is sent. It has no effect together with
+// WithManualThingPush.
+func WithThingProvider(provider ThingProvider) Option {
+	return func(c *Client) {
+		c.thingProvider = provider
+	}
+}
+
+// WithMaxConnectionAge replaces the connection with a new one after it has
+// been up for the given duration and no action is running. The thing list
+// is pushed again on the new connection.
+func WithMaxConnectionAge(age time.Duration) Option {
+	return func(c *Client) {
+		c.maxConnectionAge = age
+	}
+}
+
+// WithMaxThings limits the number of things the client accepts. Abstracting
+// more things fails, which guards against runaway discovery flooding the
+// server with definitions.
+func WithMaxThings(max int) Option {
+	return func(c *Client) {
+		c.maxThings = max
+	}
+}
+
+// WithMaxComponentsPerThing limits the number of components of a thing,
+// things with more components fail validation
+func WithMaxComponentsPerThing(max int) Option {
+	return func(c *Client) {
+		c.maxComponentsPerThing = max
+	}
+}
+
+// WithPinnedCertFingerprint only accepts ssl connections to servers
+// presenting a leaf certificate with the given SHA-256 fingerprint. The
+// fingerprint is hex encoded, colons are allowed and case is ignored. The
+// certificate still has to pass the regular verification.
+func WithPinnedCertFingerprint(fingerprint string) Option {
+	return func(c *Client) {
+		c.pinnedFingerprint = fingerprint
+	}
+}
+
+// WithResultRetention sets how long results of actions which could not be
+// sent are kept to be sent again after reconnecting, the default is one
+// minute. Zero disables resending.
+func WithResultRetention(retention time.Duration) Option {
+	return func(c *Client) {
+		c.resultRetention = retention
+	}
+}
+
+// WithMetrics reports measurements like action durations to the given
+// Metrics implementation
+func WithMetrics(metrics Metrics) Option {
+	return func(c *Client) {
+		c.metrics = metrics
+	}
+}
+
+// WithSendQueue queues property updates in front of the connection, so
+// updating a property doesn't wait for the write. The policy decides what
+// happens when more than size updates are queued. An update replaces a
+// queued update of the same property. Errors sending queued updates are
+// logged, Update only fails if the client is not connected.
+func WithSendQueue(size int, policy QueuePolicy) Option {
+	return func(c *Client) {
+		if size > 0 {
+			c.sendQueue = newSendQueue(size, policy)
+		}
+	}
+}
+
+// WithDialer replaces the connection to the server url with the one returned
+// by dial, for example a test double like testutil.Recorder
+func WithDialer(dial func(ctx context.Context) (net.Conn, error)) Option {
+	return func(c *Client) {
+		c.dialer = dial
+	}
+}
+
+// WithStrictValues makes Property.Update reject values which don't parse as
+// the declared ValueType of the property, like "on" for a Boolean, instead of
+// sending them and leaving the rejection to the server. Actions are then
+// only executed if all declared parameters are present and parse as their
+// ValueType, otherwise all invalid parameters are reported at once.
+func WithStrictValues() Option {
+	return func(c *Client) {
+		c.strictValues = true
+	}
+}
+
+// WithIdempotentActions answers Execute messages repeating one of the last
+// window sequences of the connection with the result sent before instead of
+// running the action again. Duplicates of a running action are ignored, its
+// result answers both. Sequences are only unique per connection, so they
+// are forgotten on reconnects. Each cached result costs roughly 100 bytes
+// plus the length of its error reason.
+func WithIdempotentActions(window int) Option {
+	return func(c *Client) {
+		if window > 0 {
+			c.resultCache = newResultCache(window)
+		}
+	}
+}
+
+// WithPropertySendRetries retries sending a property update up to n times,
+// waiting delay before each retry, if it failed for a transient reason like
+// a write error or a dropped connection which is being re-established.
+// The value counts as the current one while retries are pending, a newer
+// update of the property replaces it instead of waiting for the retries.
+func WithPropertySendRetries(n int, delay time.Duration) Option {
+	return func(c *Client) {
+		c.sendRetries = n
+		c.sendRetryDelay = delay
+	}
+}
+
+// WithMaxActionParameters limits the number of parameters of an action
+// invocation and their total size in bytes, counting names and values.
+// Invocations exceeding a limit are answered with FAILURE without running
+// the action. A limit of 0 disables it.
+func WithMaxActionParameters(count, size int) Option {
+	return func(c *Client) {
+		c.maxParameters = count
+		c.maxParametersSize = size
+	}
+}
+
+// UnhandledActionHandler decides the result of an Execute message for an
+// action which doesn't exist, returning the status and error reason
+type UnhandledActionHandler func(path protocol.Path, params []string) (protocol.ClientMessage_ExecutionResult_Status, string)
+
+// WithUnhandledActionHandler lets handler answer Execute messages for
+// unknown things, components or actions, for example with SUCCESS for a
+// permissive device. By default they are answered with FAILURE.
+func WithUnhandledActionHandler(handler UnhandledActionHandler) Option {
+	return func(c *Client) {
+		c.unhandledActionHandler = handler
+	}
+}
+
+// WithHandlerWatchdog logs a warning with the path of an action whose
+// handler is still running after the threshold, so hanging handlers are
+// noticed before the server times out. Once such a handler returns, its
+// duration is logged as well.
+func WithHandlerWatchdog(threshold time.Duration) Option {
+	return func(c *Client) {
+		c.handlerWatchdog = threshold
+	}
+}
+
+// WithReceiveOverflowPolicy sets what happens to server messages received
+// while the message handler is busy and the receive buffer is full. With
+// GrowOnOverflow up to maxQueued messages are queued in memory, the other
+// policies ignore maxQueued.
+func WithReceiveOverflowPolicy(policy ReceiveOverflowPolicy, maxQueued int) Option {
+	return func(c *Client) {
+		c.receivePolicy = policy
+		c.receiveOverflow = nil
+		if policy == GrowOnOverflow {
+			c.receiveOverflow = newReceiveOverflow(maxQueued)
+		}
+	}
+}
+
+// WithFrameCodec replaces the uvarint length prefixed framing of messages,
+// for example to talk to a gateway using fixed size length prefixes. The
+// maximum message size is checked on the frames returned by the codec.
+func WithFrameCodec(codec FrameCodec) Option {
+	return func(c *Client) {
+		c.customFrameCodec = codec
+	}
+}
+
+// WithTracing keeps the serialized bytes of sent messages the server can
+// reject, so OnServerError can show exactly what was sent. Protocol
+// version 1 only rejects the hello, so only hellos are kept.
+func WithTracing() Option {
+	return func(c *Client) {
+		c.tracing = true
+	}
+}
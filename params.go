@@ -0,0 +1,72 @@
+package sdk
+
+import (
+	"fmt"
+	"github.com/connctd/sdk-go/protocol"
+	"strings"
+)
+
+// ParameterError describes why a single action parameter is invalid
+type ParameterError struct {
+	Name   string
+	Reason string
+}
+
+// ParameterErrors lists all invalid parameters of an action invocation
+type ParameterErrors []ParameterError
+
+func (e ParameterErrors) Error() string {
+	reasons := make([]string, 0, len(e))
+	for _, paramErr := range e {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", paramErr.Name, paramErr.Reason))
+	}
+	return "Invalid parameters: " + strings.Join(reasons, "; ")
+}
+
+// validateParameters checks the received parameters against the parameters
+// declared by the action and reports every offending parameter at once. It
+// is only used WithStrictValues, by default the handler gets the received
+// parameters as they are.
+func validateParameters(action *Action, params []*protocol.ServerMessage_Execute_Parameter) error {
+	received := make(map[string]string, len(params))
+	for _, param := range params {
+		received[param.GetName()] = param.GetValue()
+	}
+	var errs ParameterErrors
+	for _, declared := range action.Parameters {
+		value, ok := received[declared.Name]
+		if !ok {
+			errs = append(errs, ParameterError{Name: declared.Name, Reason: "missing"})
+			continue
+		}
+		valueType := String
+		if declared.Type != nil {
+			valueType = *declared.Type
+		}
+		if err := valueType.check(value); err != nil {
+			errs = append(errs, ParameterError{Name: declared.Name, Reason: err.Error()})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// checkParameterLimits rejects invocations exceeding the parameter limits
+// set via WithMaxActionParameters, before the parameters are processed
+func (c *Client) checkParameterLimits(params []*protocol.ServerMessage_Execute_Parameter) error {
+	if c.maxParameters > 0 && len(params) > c.maxParameters {
+		return fmt.Errorf("Too many parameters: %d parameters exceed the maximum of %d", len(params), c.maxParameters)
+	}
+	if c.maxParametersSize > 0 {
+		size := 0
+		for _, param := range params {
+			size += len(param.GetName()) + len(param.GetValue())
+		}
+		if size > c.maxParametersSize {
+			return fmt.Errorf("Parameters too large: %d bytes exceed the maximum of %d", size, c.maxParametersSize)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package sdk
+
+import (
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/connctd/sdk-go/testutil"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func executeParameter(name, value string) *protocol.ServerMessage_Execute_Parameter {
+	return &protocol.ServerMessage_Execute_Parameter{Name: &name, Value: &value}
+}
+
+func TestValidateParametersAggregatesErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	number, boolean := Number, Boolean
+	action := &Action{
+		Name: "configure",
+		Parameters: []*ActionParameter{
+			{Name: "interval", Type: &number},
+			{Name: "enabled", Type: &boolean},
+			{Name: "label"},
+			{Name: "mode"},
+		},
+	}
+
+	assert.Nil(validateParameters(action, []*protocol.ServerMessage_Execute_Parameter{
+		executeParameter("interval", "1.5"),
+		executeParameter("enabled", "true"),
+		executeParameter("label", "kitchen"),
+		executeParameter("mode", "eco"),
+	}))
+
+	err := validateParameters(action, []*protocol.ServerMessage_Execute_Parameter{
+		executeParameter("interval", "often"),
+		executeParameter("enabled", "maybe"),
+		executeParameter("label", "kitchen"),
+	})
+	paramErrs, ok := err.(ParameterErrors)
+	assert.True(ok)
+	assert.Len(paramErrs, 3)
+	assert.Equal("interval", paramErrs[0].Name)
+	assert.Equal("enabled", paramErrs[1].Name)
+	assert.Equal(ParameterError{Name: "mode", Reason: "missing"}, paramErrs[2])
+	assert.Contains(err.Error(), "interval: \"often\" is not a NUMBER")
+}
+
+func TestParameterValidationOnlyWithStrictValues(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, strict := range []bool{false, true} {
+		recorder := testutil.NewRecorder()
+		options := []Option{WithDialer(recorder.Dial)}
+		if strict {
+			options = append(options, WithStrictValues())
+		}
+		client, _ := NewClient("tcp://test", options...)
+		number, str := Number, String
+		thing := newTestThing("thing1")
+		runs := 0
+		thing.Components[0].Capabilities[0].Actions = []*Action{
+			{
+				Name:       "configure",
+				Parameters: []*ActionParameter{{Name: "interval", Type: &number}, {Name: "label", Type: &str}},
+				Execute: func(action Action, params []string) error {
+					runs++
+					return nil
+				},
+			},
+		}
+		assert.Nil(client.Abstract(thing))
+		assert.Nil(client.Connect("unit", "token"))
+
+		thingId, componentId, actionName, sequence := "thing1", "main", "configure", uint64(1)
+		client.handleAction(&protocol.ServerMessage_Execute{
+			Sequence:   &sequence,
+			Path:       &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+			Parameters: []*protocol.ServerMessage_Execute_Parameter{executeParameter("interval", "often")},
+		}, time.Now())
+		result := recorder.ExecutionResults()[0]
+		if strict {
+			assert.Equal(protocol.ClientMessage_ExecutionResult_FAILURE, result.GetResult())
+			assert.Equal("Invalid parameters: interval: \"often\" is not a NUMBER; label: missing", result.GetErrorReason())
+			assert.Equal(0, runs)
+		} else {
+			assert.Equal(protocol.ClientMessage_ExecutionResult_SUCCESS, result.GetResult())
+			assert.Equal(1, runs)
+		}
+		client.Disconnect()
+	}
+}
+
+func TestMaxActionParameters(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := testutil.NewRecorder()
+	client, _ := NewClient("tcp://test", WithDialer(recorder.Dial), WithMaxActionParameters(2, 64))
+	thing := newTestThing("thing1")
+	runs := 0
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{
+			Name: "configure",
+			Execute: func(action Action, params []string) error {
+				runs++
+				return nil
+			},
+		},
+	}
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+
+	thingId, componentId, actionName, sequence := "thing1", "main", "configure", uint64(0)
+	execute := func(params ...*protocol.ServerMessage_Execute_Parameter) *protocol.ClientMessage_ExecutionResult {
+		sequence++
+		client.handleAction(&protocol.ServerMessage_Execute{
+			Sequence:   &sequence,
+			Path:       &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+			Parameters: params,
+		}, time.Now())
+		results := recorder.ExecutionResults()
+		return results[len(results)-1]
+	}
+
+	result := execute(executeParameter("a", "1"), executeParameter("b", "2"), executeParameter("c", "3"))
+	assert.Equal(protocol.ClientMessage_ExecutionResult_FAILURE, result.GetResult())
+	assert.Equal("Too many parameters: 3 parameters exceed the maximum of 2", result.GetErrorReason())
+
+	result = execute(executeParameter("blob", strings.Repeat("x", 1<<20)))
+	assert.Equal(protocol.ClientMessage_ExecutionResult_FAILURE, result.GetResult())
+	assert.Equal("Parameters too large: 1048580 bytes exceed the maximum of 64", result.GetErrorReason())
+	assert.Equal(0, runs)
+
+	result = execute(executeParameter("a", "1"))
+	assert.Equal(protocol.ClientMessage_ExecutionResult_SUCCESS, result.GetResult())
+	assert.Equal(1, runs)
+}
@@ -0,0 +1,120 @@
+package sdk
+
+import (
+	"github.com/connctd/sdk-go/protocol"
+)
+
+// PauseMode decides what happens to actions received while the client is
+// paused
+type PauseMode byte
+
+const (
+	// QueuePausedActions keeps actions received while paused and executes
+	// them in order on Resume, this is the default. At most 100 actions are
+	// kept, further ones are answered with a FAILURE result.
+	QueuePausedActions PauseMode = iota
+	// RejectPausedActions answers actions received while paused with a
+	// FAILURE result
+	RejectPausedActions
+)
+
+// reasonPaused is reported for actions rejected while the client is paused
+const reasonPaused = "Device is temporarily unavailable"
+
+// reasonQueueFull is reported for actions rejected while paused because
+// the queue of paused actions is full
+const reasonQueueFull = "Too many actions queued while paused"
+
+// reasonDraining is reported for actions received while the client drains
+// its running actions before disconnecting
+const reasonDraining = "Client is disconnecting"
+
+// Pause stops the execution of incoming actions without disconnecting.
+// Depending on the PauseMode set via WithPauseMode actions are queued or
+// rejected until Resume is called. Other server messages are handled as
+// usual.
+func (c *Client) Pause() {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	c.paused = true
+	c.resuming = false
+}
+
+// Resume executes the actions queued while paused in the order they were
+// received and resumes normal processing afterwards. Actions arriving while
+// the queue is worked off are appended to it, so ordering is kept.
+func (c *Client) Resume() {
+	c.stateLock.Lock()
+	if !c.paused || c.resuming {
+		c.stateLock.Unlock()
+		return
+	}
+	c.resuming = true
+	c.stateLock.Unlock()
+	for {
+		c.stateLock.Lock()
+		if !c.resuming {
+			// paused again while working off the queue
+			c.stateLock.Unlock()
+			return
+		}
+		if len(c.pausedActions) == 0 {
+			c.paused = false
+			c.resuming = false
+			c.stateLock.Unlock()
+			return
+		}
+		received := c.pausedActions[0]
+		c.pausedActions = c.pausedActions[1:]
+		c.stateLock.Unlock()
+		c.handleAction(received.msg.GetAction(), received.receivedAt)
+	}
+}
+
+// IsPaused returns true if Pause was called and the client was not resumed
+// yet
+func (c *Client) IsPaused() bool {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	return c.paused
+}
+
+// holdAction queues or rejects the action if the client is paused. It
+// returns false if the action should be handled right away.
+func (c *Client) holdAction(received receivedMessage) bool {
+	c.stateLock.Lock()
+	if !c.paused {
+		c.stateLock.Unlock()
+		return false
+	}
+	reason := reasonPaused
+	if c.pauseMode == QueuePausedActions {
+		// The queue is bounded like the undelivered results, the server
+		// gets a FAILURE for actions beyond it instead
+		if len(c.pausedActions) < maxUndeliveredResults {
+			c.pausedActions = append(c.pausedActions, received)
+			c.stateLock.Unlock()
+			return true
+		}
+		reason = reasonQueueFull
+	}
+	c.stateLock.Unlock()
+	c.rejectAction(received.msg.GetAction(), reason)
+	return true
+}
+
+// rejectAction answers an action which is not executed with FAILURE, so
+// the server doesn't wait for its result
+func (c *Client) rejectAction(msg *protocol.ServerMessage_Execute, reason string) {
+	params := make([]string, 0, len(msg.GetParameters()))
+	for _, param := range msg.GetParameters() {
+		params = append(params, param.GetValue())
+	}
+	status := protocol.ClientMessage_ExecutionResult_FAILURE
+	c.sendResult(&protocol.ClientMessage_ExecutionResult{
+		ErrorReason: &reason,
+		Result:      &status,
+		Sequence:    msg.Sequence,
+	})
+	c.recordAction(msg, params, status, reason, 0)
+}
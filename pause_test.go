@@ -0,0 +1,105 @@
+package sdk
+
+import (
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newPauseTestClient(t *testing.T, options ...Option) (*Client, *testServerConn, chan string) {
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url, options...)
+	thing := newTestThing("thing1")
+	executed := make(chan string, 10)
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{
+			Name: "toggle",
+			Execute: func(action Action, params []string) error {
+				executed <- action.Name
+				return nil
+			},
+		},
+	}
+	assert.Nil(t, client.Abstract(thing))
+	assert.Nil(t, client.Connect("unit", "token"))
+	server := <-conns
+	assert.NotNil(t, server.readClientMessage(t).GetHello())
+	return client, server, executed
+}
+
+func sendToggle(t *testing.T, server *testServerConn, sequence uint64) {
+	thingId, componentId, actionName := "thing1", "main", "toggle"
+	server.writeServerMessage(t, &protocol.ServerMessage{Action: &protocol.ServerMessage_Execute{
+		Sequence: &sequence,
+		Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+	}})
+}
+
+func TestPauseQueuesActions(t *testing.T) {
+	assert := assert.New(t)
+
+	client, server, executed := newPauseTestClient(t)
+	defer client.Disconnect()
+
+	client.Pause()
+	assert.True(client.IsPaused())
+	sendToggle(t, server, 1)
+	sendToggle(t, server, 2)
+	for i := 0; i < 100; i++ {
+		client.stateLock.Lock()
+		queued := len(client.pausedActions)
+		client.stateLock.Unlock()
+		if queued == 2 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Len(executed, 0)
+
+	client.Resume()
+	assert.False(client.IsPaused())
+	assert.Len(executed, 2)
+	assert.Equal(uint64(1), server.readClientMessage(t).GetExecutionResult().GetSequence())
+	assert.Equal(uint64(2), server.readClientMessage(t).GetExecutionResult().GetSequence())
+}
+
+func TestPauseRejectsActions(t *testing.T) {
+	assert := assert.New(t)
+
+	client, server, executed := newPauseTestClient(t, WithPauseMode(RejectPausedActions))
+	defer client.Disconnect()
+
+	client.Pause()
+	sendToggle(t, server, 1)
+	result := server.readClientMessage(t).GetExecutionResult()
+	assert.Equal(protocol.ClientMessage_ExecutionResult_FAILURE, result.GetResult())
+	assert.Equal(reasonPaused, result.GetErrorReason())
+	assert.Len(executed, 0)
+
+	client.Resume()
+	sendToggle(t, server, 2)
+	result = server.readClientMessage(t).GetExecutionResult()
+	assert.Equal(protocol.ClientMessage_ExecutionResult_SUCCESS, result.GetResult())
+	assert.Len(executed, 1)
+}
+
+func TestPauseQueueIsBounded(t *testing.T) {
+	assert := assert.New(t)
+
+	client, server, executed := newPauseTestClient(t)
+	defer client.Disconnect()
+
+	client.Pause()
+	for i := 1; i <= maxUndeliveredResults+1; i++ {
+		sendToggle(t, server, uint64(i))
+	}
+	result := server.readClientMessage(t).GetExecutionResult()
+	assert.Equal(uint64(maxUndeliveredResults+1), result.GetSequence())
+	assert.Equal(protocol.ClientMessage_ExecutionResult_FAILURE, result.GetResult())
+	assert.Equal(reasonQueueFull, result.GetErrorReason())
+	client.stateLock.Lock()
+	assert.Len(client.pausedActions, maxUndeliveredResults)
+	client.stateLock.Unlock()
+	assert.Len(executed, 0)
+}
@@ -0,0 +1,205 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ClientPool distributes things over several connections to the server.
+// Things are assigned to a connection by hashing their Id unless they are
+// pinned to a connection explicitly via AbstractOn.
+type ClientPool struct {
+	clients []*Client
+	lock    *sync.Mutex
+	owners  map[string]int
+	// closed is set by Shutdown, guarded by lock
+	closed bool
+}
+
+// ErrPoolClosed is returned when using a pool after Shutdown
+var ErrPoolClosed = errors.New("Client pool is shut down")
+
+// ShutdownErrors reports the clients of a pool which failed to shut down
+// cleanly, keyed by their connection index
+type ShutdownErrors map[int]error
+
+func (e ShutdownErrors) Error() string {
+	indexes := make([]int, 0, len(e))
+	for index := range e {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	msgs := make([]string, 0, len(e))
+	for _, index := range indexes {
+		msgs = append(msgs, fmt.Sprintf("client %d: %v", index, e[index]))
+	}
+	return "Shutting down the client pool failed: " + strings.Join(msgs, "; ")
+}
+
+// NewClientPool creates a pool of size clients, all connecting to url and
+// configured with the given options
+func NewClientPool(url string, size int, options ...Option) (*ClientPool, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("A client pool needs at least one client")
+	}
+	pool := &ClientPool{
+		clients: make([]*Client, 0, size),
+		lock:    &sync.Mutex{},
+		owners:  make(map[string]int),
+	}
+	for i := 0; i < size; i++ {
+		client, err := NewClient(url, options...)
+		if err != nil {
+			return nil, err
+		}
+		pool.clients = append(pool.clients, client)
+	}
+	return pool, nil
+}
+
+// Connect connects all clients of the pool. If a client fails to connect,
+// the clients connected before it are disconnected again, so the pool is
+// either connected completely or not at all.
+func (p *ClientPool) Connect(unitId, token string) error {
+	if p.isClosed() {
+		return ErrPoolClosed
+	}
+	for i, client := range p.clients {
+		if err := client.Connect(unitId, token); err != nil {
+			for _, connected := range p.clients[:i] {
+				connected.Disconnect()
+			}
+			return fmt.Errorf("Connecting client %d failed: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Clients returns the clients of the pool
+func (p *ClientPool) Clients() []*Client {
+	return append([]*Client(nil), p.clients...)
+}
+
+// Abstract adds the things to the connections their Ids hash to
+func (p *ClientPool) Abstract(things ...*Thing) error {
+	for _, thing := range things {
+		if err := p.abstractOn(p.index(thing.Id), thing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AbstractOn adds the things to the connection with the given index, e.g.
+// to keep all things of a site on the same connection
+func (p *ClientPool) AbstractOn(connIndex int, things ...*Thing) error {
+	if connIndex < 0 || connIndex >= len(p.clients) {
+		return fmt.Errorf("Invalid connection index %d for a pool of %d clients", connIndex, len(p.clients))
+	}
+	for _, thing := range things {
+		if err := p.abstractOn(connIndex, thing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// abstractOn reserves the Id under the pool lock and calls into the client
+// without holding it, so a slow client does not block the whole pool
+func (p *ClientPool) abstractOn(connIndex int, thing *Thing) error {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return ErrPoolClosed
+	}
+	if owner, ok := p.owners[thing.Id]; ok {
+		p.lock.Unlock()
+		return fmt.Errorf("The thing with the Id %s already exists on connection %d", thing.Id, owner)
+	}
+	p.owners[thing.Id] = connIndex
+	p.lock.Unlock()
+
+	if err := p.clients[connIndex].Abstract(thing); err != nil {
+		p.lock.Lock()
+		delete(p.owners, thing.Id)
+		p.lock.Unlock()
+		return err
+	}
+	return nil
+}
+
+// RemoveThing removes the thing from the connection owning it
+func (p *ClientPool) RemoveThing(thing *Thing) error {
+	owner, ok := p.Owner(thing.Id)
+	if !ok {
+		return fmt.Errorf("Thing with Id %s not found", thing.Id)
+	}
+	if err := p.clients[owner].RemoveThing(thing); err != nil {
+		return err
+	}
+	p.lock.Lock()
+	delete(p.owners, thing.Id)
+	p.lock.Unlock()
+	return nil
+}
+
+// Owner returns the index of the connection the thing is abstracted on
+func (p *ClientPool) Owner(thingId string) (int, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	owner, ok := p.owners[thingId]
+	return owner, ok
+}
+
+// Shutdown disconnects all clients in parallel. The pool refuses new things
+// and connects right away. Each client stops handling server messages and
+// gets until the context is done to finish its running actions and to end
+// its goroutines, like the read loop and pending listener calls. Clients
+// still running actions or goroutines at that point are disconnected anyway
+// and reported in the returned ShutdownErrors.
+func (p *ClientPool) Shutdown(ctx context.Context) error {
+	p.lock.Lock()
+	p.closed = true
+	p.lock.Unlock()
+
+	var wg sync.WaitGroup
+	var errsLock sync.Mutex
+	errs := make(ShutdownErrors)
+	for i, client := range p.clients {
+		wg.Add(1)
+		go func(i int, client *Client) {
+			defer wg.Done()
+			err := client.disconnectWithDrain(ctx)
+			if err == nil || err == ErrNotConnected {
+				err = client.waitForGoroutines(ctx)
+			}
+			if err != nil {
+				errsLock.Lock()
+				errs[i] = err
+				errsLock.Unlock()
+			}
+		}(i, client)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (p *ClientPool) isClosed() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.closed
+}
+
+func (p *ClientPool) index(thingId string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(thingId))
+	return int(hash.Sum32() % uint32(len(p.clients)))
+}
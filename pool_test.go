@@ -0,0 +1,141 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientPoolAssignment(t *testing.T) {
+	assert := assert.New(t)
+
+	pool, err := NewClientPool("tcp://localhost:1234", 3)
+	assert.Nil(err)
+
+	assert.Nil(pool.AbstractOn(2, newTestThing("site1"), newTestThing("site2")))
+	assert.Nil(pool.Abstract(newTestThing("thing1")))
+	assert.Error(pool.AbstractOn(3, newTestThing("thing2")))
+	assert.Error(pool.Abstract(newTestThing("site1")))
+
+	owner, ok := pool.Owner("site2")
+	assert.True(ok)
+	assert.Equal(2, owner)
+	owner, ok = pool.Owner("thing1")
+	assert.True(ok)
+	assert.Equal(pool.index("thing1"), owner)
+	assert.NotNil(pool.Clients()[owner].getThing("thing1"))
+
+	assert.Nil(pool.RemoveThing(newTestThing("site2")))
+	_, ok = pool.Owner("site2")
+	assert.False(ok)
+}
+
+func TestClientPoolShutdown(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	pool, err := NewClientPool(url, 2)
+	assert.Nil(err)
+	thing := newTestThing("thing1")
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{
+			Name: "stuck",
+			Execute: func(action Action, params []string) error {
+				close(started)
+				<-release
+				return nil
+			},
+		},
+	}
+	assert.Nil(pool.AbstractOn(1, thing))
+	assert.Nil(pool.Connect("unit", "token"))
+
+	thingId, componentId, actionName, sequence := "thing1", "main", "stuck", uint64(1)
+	for i := 0; i < 2; i++ {
+		server := <-conns
+		assert.NotNil(server.readClientMessage(t).GetHello())
+		server.writeServerMessage(t, &protocol.ServerMessage{Action: &protocol.ServerMessage_Execute{
+			Sequence: &sequence,
+			Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+		}})
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = pool.Shutdown(ctx)
+	errs, ok := err.(ShutdownErrors)
+	assert.True(ok)
+	assert.Len(errs, 1)
+	assert.Error(errs[1])
+	assert.Contains(err.Error(), "client 1")
+	for _, client := range pool.Clients() {
+		assert.False(client.IsConnected())
+	}
+
+	assert.Equal(ErrPoolClosed, pool.Abstract(newTestThing("thing2")))
+	assert.Equal(ErrPoolClosed, pool.Connect("unit", "token"))
+}
+
+func TestClientPoolConnectFailureDisconnects(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	dials := int32(0)
+	pool, err := NewClientPool(url, 2, WithDialer(func(ctx context.Context) (net.Conn, error) {
+		if atomic.AddInt32(&dials, 1) > 1 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return net.Dial("tcp", strings.TrimPrefix(url, "tcp://"))
+	}))
+	assert.Nil(err)
+
+	err = pool.Connect("unit", "token")
+	assert.Error(err)
+	assert.Contains(err.Error(), "client 1")
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+	_, err = server.reader.ReadByte()
+	assert.Equal(io.EOF, err)
+	for _, client := range pool.Clients() {
+		assert.False(client.IsConnected())
+	}
+}
+
+func TestClientPoolShutdownWaitsForGoroutines(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	pool, err := NewClientPool(url, 2)
+	assert.Nil(err)
+	assert.Nil(pool.Connect("unit", "token"))
+	for i := 0; i < 2; i++ {
+		server := <-conns
+		assert.NotNil(server.readClientMessage(t).GetHello())
+	}
+	release := make(chan struct{})
+	pool.Clients()[1].runCallback("blocking", func() { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = pool.Shutdown(ctx)
+	errs, ok := err.(ShutdownErrors)
+	assert.True(ok)
+	assert.Len(errs, 1)
+	assert.True(errors.Is(errs[1], context.DeadlineExceeded))
+	assert.Equal(0, pool.Clients()[0].Goroutines())
+
+	close(release)
+	waitFor(func() bool { return pool.Clients()[1].Goroutines() == 0 })
+	assert.Equal(0, pool.Clients()[1].Goroutines())
+}
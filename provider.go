@@ -0,0 +1,78 @@
+package sdk
+
+import (
+	"fmt"
+)
+
+// ThingProvider returns the current things of a dynamic fleet, see
+// WithThingProvider
+type ThingProvider func() ([]*Thing, error)
+
+// refreshProvidedThings replaces the things returned by the previous call of
+// the thing provider with the ones it returns now. Things added via Abstract
+// are kept. If the provider fails or returns invalid things, the thing list
+// stays unchanged.
+func (c *Client) refreshProvidedThings() error {
+	things, err := c.thingProvider()
+	if err != nil {
+		return err
+	}
+	dropped, err := c.replaceProvidedThings(things)
+	// The property locks must not be taken with thingsLock held
+	stopRefreshing(dropped...)
+	return err
+}
+
+// replaceProvidedThings swaps the provided things and returns the ones
+// which are no longer part of the thing list
+func (c *Client) replaceProvidedThings(things []*Thing) ([]*Thing, error) {
+	c.thingsLock.Lock()
+	defer c.thingsLock.Unlock()
+	static := make([]*Thing, 0, len(c.things)+len(things))
+	ids := make(map[string]bool, len(c.things)+len(things))
+	for _, thing := range c.things {
+		if !c.providedThings[thing.Id] {
+			static = append(static, thing)
+			ids[thing.Id] = true
+		}
+	}
+	if err := c.checkThingCount(len(static) + len(things)); err != nil {
+		return nil, err
+	}
+	for _, thing := range things {
+		if ids[thing.Id] {
+			return nil, fmt.Errorf("The thing with the Id %s already exists", thing.Id)
+		}
+		ids[thing.Id] = true
+		if err := c.validateDefinition(thing); err != nil {
+			return nil, err
+		}
+	}
+	provided := make(map[string]bool, len(things))
+	kept := make(map[*Thing]bool, len(things))
+	for _, thing := range things {
+		c.wire(thing)
+		provided[thing.Id] = true
+		kept[thing] = true
+	}
+	dropped := make([]*Thing, 0)
+	for _, thing := range c.things {
+		if c.providedThings[thing.Id] && !kept[thing] {
+			dropped = append(dropped, thing)
+		}
+	}
+	c.things = append(static, things...)
+	c.providedThings = provided
+	return dropped, nil
+}
+
+// answerRequestThings sends the thing list in response to RequestThings,
+// asking the thing provider for the current things first
+func (c *Client) answerRequestThings() error {
+	if c.thingProvider != nil {
+		if err := c.refreshProvidedThings(); err != nil {
+			c.logger.Error("Thing provider failed, sending the previous things", F("error", err))
+		}
+	}
+	return c.sendThings()
+}
@@ -0,0 +1,93 @@
+package sdk
+
+import (
+	"errors"
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/connctd/sdk-go/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func thingIds(response *protocol.ClientMessage_RequestThingsResponse) []string {
+	ids := make([]string, 0, len(response.GetThings()))
+	for _, thing := range response.GetThings() {
+		ids = append(ids, thing.GetId())
+	}
+	return ids
+}
+
+func TestThingProvider(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	calls := 0
+	provider := func() ([]*Thing, error) {
+		calls++
+		switch calls {
+		case 1:
+			return []*Thing{newTestThing("dynamic1")}, nil
+		case 2:
+			return []*Thing{newTestThing("dynamic2"), newTestThing("dynamic3")}, nil
+		}
+		return nil, errors.New("Discovery failed")
+	}
+	client, _ := NewClient(url, WithThingProvider(provider), WithLogger(&recordingLogger{}))
+	assert.Nil(client.Abstract(newTestThing("static")))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+
+	requestThings := &protocol.ServerMessage{RequestThings: &protocol.ServerMessage_RequestThings{}}
+	server.writeServerMessage(t, requestThings)
+	assert.Equal([]string{"dynamic1", "static"}, thingIds(server.readClientMessage(t).GetRequestThingsResponse()))
+
+	server.writeServerMessage(t, requestThings)
+	assert.Equal([]string{"dynamic2", "dynamic3", "static"}, thingIds(server.readClientMessage(t).GetRequestThingsResponse()))
+	assert.NotNil(client.getThing("dynamic2"))
+	assert.Nil(client.getThing("dynamic1"))
+
+	server.writeServerMessage(t, requestThings)
+	assert.Equal([]string{"dynamic2", "dynamic3", "static"}, thingIds(server.readClientMessage(t).GetRequestThingsResponse()))
+}
+
+func TestThingProviderRejectsInvalidThings(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234", WithThingProvider(func() ([]*Thing, error) {
+		return []*Thing{newTestThing("static")}, nil
+	}))
+	assert.Nil(client.Abstract(newTestThing("static")))
+	assert.Error(client.refreshProvidedThings())
+	assert.Equal(1, client.Status().Things)
+}
+
+func TestDroppedProvidedThingStopsRefreshing(t *testing.T) {
+	assert := assert.New(t)
+
+	dropped := newTestThing("dynamic1")
+	property := dropped.Components[0].Capabilities[0].Properties[0]
+	property.TTL = time.Hour
+	calls := 0
+	recorder := testutil.NewRecorder()
+	client, _ := NewClient("tcp://test", WithDialer(recorder.Dial), WithThingProvider(func() ([]*Thing, error) {
+		calls++
+		if calls == 1 {
+			return []*Thing{dropped}, nil
+		}
+		return []*Thing{newTestThing("dynamic2")}, nil
+	}))
+	assert.Nil(client.refreshProvidedThings())
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	assert.Nil(property.Update("21.5"))
+	property.lock.Lock()
+	assert.NotNil(property.refreshTimer)
+	property.lock.Unlock()
+
+	assert.Nil(client.refreshProvidedThings())
+	property.lock.Lock()
+	assert.Nil(property.refreshTimer)
+	property.lock.Unlock()
+}
@@ -0,0 +1,147 @@
+package sdk
+
+import (
+	"sync"
+)
+
+// ReceiveOverflowPolicy decides what happens to received server messages
+// while the message handler is busy and the receive buffer is full
+type ReceiveOverflowPolicy byte
+
+const (
+	// BlockOnOverflow stops reading from the connection until the handler
+	// catches up, this is the default
+	BlockOnOverflow ReceiveOverflowPolicy = iota
+	// DropOnOverflow drops the message and counts it as MetricReceiveDropped,
+	// for devices which rather lose a message than stall the connection
+	DropOnOverflow
+	// GrowOnOverflow queues the message in memory up to the configured
+	// limit and blocks once the limit is reached
+	GrowOnOverflow
+)
+
+const (
+	// MetricReceiveDropped counts server messages dropped because the
+	// message handler was busy
+	MetricReceiveDropped = "receive.dropped"
+)
+
+// receiveOverflow holds messages which didn't fit into the receive buffer,
+// oldest first. While it holds messages, new ones are appended to it, so
+// messages are handled in order.
+type receiveOverflow struct {
+	lock     *sync.Mutex
+	pending  []queuedMessage
+	maxCount int
+	// freed is closed and replaced whenever messages leave the queue
+	freed chan struct{}
+}
+
+// queuedMessage is a message in the overflow queue together with the done
+// channel of the connection it was received on
+type queuedMessage struct {
+	done chan struct{}
+	msg  receivedMessage
+}
+
+func newReceiveOverflow(maxCount int) *receiveOverflow {
+	return &receiveOverflow{lock: &sync.Mutex{}, maxCount: maxCount, freed: make(chan struct{})}
+}
+
+// signalFreed wakes up dispatchers waiting for room in the queue. The
+// caller must hold the lock.
+func (q *receiveOverflow) signalFreed() {
+	close(q.freed)
+	q.freed = make(chan struct{})
+}
+
+// clear drops the queued messages of the connection with the given done
+// channel, they must not be handled on the next connection
+func (q *receiveOverflow) clear(done chan struct{}) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	pending := q.pending[:0]
+	for _, queued := range q.pending {
+		if queued.done != done {
+			pending = append(pending, queued)
+		}
+	}
+	if len(pending) < len(q.pending) {
+		for i := len(pending); i < len(q.pending); i++ {
+			q.pending[i] = queuedMessage{}
+		}
+		q.pending = pending
+		q.signalFreed()
+	}
+}
+
+// dispatchOrDrop hands a message to the handler or drops it if the handler
+// is busy
+func (c *Client) dispatchOrDrop(done chan struct{}, msg receivedMessage) bool {
+	select {
+	case c.receiveChan <- msg:
+	case <-done:
+		return false
+	default:
+		c.metrics.Count(MetricReceiveDropped, 1)
+	}
+	return true
+}
+
+// dispatchOrQueue hands a message to the handler or queues it if the handler
+// is busy. Once the queue holds the maximum, it waits for the handler.
+func (c *Client) dispatchOrQueue(done chan struct{}, msg receivedMessage) bool {
+	q := c.receiveOverflow
+	for {
+		q.lock.Lock()
+		// Checked under the lock, so nothing is queued after teardown
+		// cleared the queue
+		select {
+		case <-done:
+			q.lock.Unlock()
+			return false
+		default:
+		}
+		if len(q.pending) == 0 {
+			select {
+			case c.receiveChan <- msg:
+				q.lock.Unlock()
+				return true
+			default:
+			}
+		}
+		if len(q.pending) < q.maxCount {
+			q.pending = append(q.pending, queuedMessage{done: done, msg: msg})
+			q.lock.Unlock()
+			return true
+		}
+		freed := q.freed
+		q.lock.Unlock()
+		select {
+		case <-done:
+			return false
+		case <-freed:
+		}
+	}
+}
+
+// nextOverflow returns the oldest queued message once the receive buffer is
+// empty, so queued messages are handled after the buffered ones
+func (c *Client) nextOverflow() (receivedMessage, bool) {
+	q := c.receiveOverflow
+	if q == nil {
+		return receivedMessage{}, false
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	// Checked under the lock, dispatchOrQueue only sends to the buffer
+	// while the queue is empty
+	if len(q.pending) == 0 || len(c.receiveChan) > 0 {
+		return receivedMessage{}, false
+	}
+	msg := q.pending[0].msg
+	q.pending[0] = queuedMessage{}
+	q.pending = q.pending[1:]
+	q.signalFreed()
+	return msg, true
+}
@@ -0,0 +1,138 @@
+package sdk
+
+import (
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+// newBlockedClient connects a client whose message handler is blocked in
+// the action "block" until release is closed and sends it count further
+// actions with the sequences 1 to count
+func newBlockedClient(t *testing.T, count int, options ...Option) (*Client, chan struct{}, func() []uint64) {
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url, options...)
+	thing := newTestThing("thing1")
+	release := make(chan struct{})
+	started := make(chan struct{})
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{
+			Name: "block",
+			Execute: func(action Action, params []string) error {
+				close(started)
+				<-release
+				return nil
+			},
+		},
+	}
+	var lock sync.Mutex
+	sequences := make([]uint64, 0)
+	client.OnActionReceived = func(path protocol.Path, params []string, sequence uint64) {
+		lock.Lock()
+		defer lock.Unlock()
+		sequences = append(sequences, sequence)
+	}
+	if err := client.Abstract(thing); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Connect("unit", "token"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Disconnect() })
+	server := <-conns
+	server.readClientMessage(t)
+
+	thingId, componentId := "thing1", "main"
+	for i := 0; i <= count; i++ {
+		actionName, sequence := "other", uint64(i)
+		if i == 0 {
+			actionName = "block"
+		}
+		server.writeServerMessage(t, &protocol.ServerMessage{Action: &protocol.ServerMessage_Execute{
+			Sequence: &sequence,
+			Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+		}})
+		if i == 0 {
+			<-started
+		}
+	}
+	return client, release, func() []uint64 {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]uint64(nil), sequences...)
+	}
+}
+
+func TestReceiveOverflowDrop(t *testing.T) {
+	assert := assert.New(t)
+
+	metrics := newRecordingMetrics()
+	_, release, _ := newBlockedClient(t, 15, WithMetrics(metrics), WithReceiveOverflowPolicy(DropOnOverflow, 0))
+	defer close(release)
+	dropped := func() int64 {
+		metrics.lock.Lock()
+		defer metrics.lock.Unlock()
+		return metrics.counts[MetricReceiveDropped]
+	}
+	waitFor(func() bool { return dropped() == 5 })
+	assert.Equal(int64(5), dropped())
+}
+
+func TestReceiveOverflowGrow(t *testing.T) {
+	assert := assert.New(t)
+
+	client, release, received := newBlockedClient(t, 15, WithReceiveOverflowPolicy(GrowOnOverflow, 4))
+	waitFor(func() bool {
+		client.receiveOverflow.lock.Lock()
+		defer client.receiveOverflow.lock.Unlock()
+		return len(client.receiveOverflow.pending) == 4
+	})
+	// The last message waits for room in the full queue
+	close(release)
+	waitFor(func() bool { return len(received()) == 16 })
+	expected := make([]uint64, 0, 16)
+	for i := uint64(0); i <= 15; i++ {
+		expected = append(expected, i)
+	}
+	assert.Equal(expected, received())
+}
+
+func TestReceiveOverflowClearedOnTeardown(t *testing.T) {
+	assert := assert.New(t)
+
+	client, release, received := newBlockedClient(t, 15, WithReceiveOverflowPolicy(GrowOnOverflow, 4))
+	defer close(release)
+	waitFor(func() bool {
+		client.receiveOverflow.lock.Lock()
+		defer client.receiveOverflow.lock.Unlock()
+		return len(client.receiveOverflow.pending) == 4
+	})
+	client.stateLock.Lock()
+	done := client.done
+	client.stateLock.Unlock()
+	assert.True(client.teardown(done))
+
+	client.receiveOverflow.lock.Lock()
+	defer client.receiveOverflow.lock.Unlock()
+	assert.Empty(client.receiveOverflow.pending)
+	assert.Equal([]uint64{0}, received())
+}
+
+func TestReceiveOverflowWakesWaitingDispatcher(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &Client{receiveChan: make(chan receivedMessage), receiveOverflow: newReceiveOverflow(1)}
+	done := make(chan struct{})
+	defer close(done)
+	assert.True(client.dispatchOrQueue(done, receivedMessage{}))
+	dispatched := make(chan bool)
+	go func() { dispatched <- client.dispatchOrQueue(done, receivedMessage{}) }()
+
+	_, ok := client.nextOverflow()
+	assert.True(ok)
+	assert.True(<-dispatched)
+	client.receiveOverflow.lock.Lock()
+	defer client.receiveOverflow.lock.Unlock()
+	assert.Len(client.receiveOverflow.pending, 1)
+}
@@ -0,0 +1,131 @@
+package sdk
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+type reconnectConfig struct {
+	maxAttempts int
+	minDelay    time.Duration
+	maxDelay    time.Duration
+}
+
+// reconnectLoop tries to reestablish a lost connection with exponential
+// backoff until it succeeds, the attempts are exhausted or the application
+// disconnects the client
+func (c *Client) reconnectLoop() {
+	c.stateLock.Lock()
+	if c.reconnecting || c.closed {
+		c.stateLock.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	c.reconnectStop = stop
+	c.reconnecting = true
+	c.reconnectAttempts = 0
+	config := *c.reconnect
+	unitId, token, lastErr := c.unitId, c.token, c.lastErr
+	c.stateLock.Unlock()
+
+	delay := config.minDelay
+	attempt := 1
+	for ; config.maxAttempts <= 0 || attempt <= config.maxAttempts; attempt++ {
+		if onAttempt := c.OnReconnectAttempt; onAttempt != nil {
+			attempt, delay, lastErr := attempt, delay, lastErr
+			c.runCallback("OnReconnectAttempt", func() { onAttempt(attempt, delay, lastErr) })
+		}
+		select {
+		case <-stop:
+			c.finishReconnect(stop)
+			return
+		case <-time.After(delay):
+		}
+		c.stateLock.Lock()
+		c.reconnectAttempts = attempt
+		c.stateLock.Unlock()
+		if lastErr = c.connect(context.Background(), unitId, token, false, nil); lastErr == nil {
+			c.logger.Info("Reconnected", F("attempts", attempt))
+			c.finishReconnect(stop)
+			return
+		}
+		if lastErr == ErrNotConnected {
+			// Disconnected while dialing
+			c.finishReconnect(stop)
+			return
+		}
+		c.errorLog.log(c.logger.Error, "Reconnect attempt failed", F("attempt", attempt), F("error", lastErr))
+		delay = delay * 2
+		if delay > config.maxDelay {
+			delay = config.maxDelay
+		}
+	}
+	c.finishReconnect(stop)
+	c.logger.Error("Giving up reconnecting", F("attempts", attempt-1))
+	if onFailed := c.OnReconnectFailed; onFailed != nil {
+		c.runCallback("OnReconnectFailed", func() { onFailed(attempt-1, lastErr) })
+	}
+}
+
+func (c *Client) finishReconnect(stop chan struct{}) {
+	c.stateLock.Lock()
+	if c.reconnectStop == stop {
+		c.reconnectStop = nil
+	}
+	c.reconnecting = false
+	c.stateLock.Unlock()
+}
+
+// expireConnection replaces the connection with a fresh one once it reached
+// the maximum connection age. It waits for running actions to finish
+// first, so the connection is cycled in a quiet moment. The new connection
+// is established before the old one is closed, so the application does not
+// see a disconnect. If connecting fails, the old connection is kept and
+// cycling is tried again after another period.
+func (c *Client) expireConnection(conn net.Conn, done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(c.maxConnectionAge):
+		}
+		for c.runningActionCount() > 0 {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		c.stateLock.Lock()
+		cycle := !c.closed && !c.draining && c.done == done
+		unitId, token := c.unitId, c.token
+		c.stateLock.Unlock()
+		if !cycle {
+			return
+		}
+		c.logger.Info("Cycling connection", F("maxAge", c.maxConnectionAge))
+		if err := c.connect(context.Background(), unitId, token, false, done); err != nil {
+			c.stateLock.Lock()
+			replaced := c.done != done
+			c.stateLock.Unlock()
+			if replaced {
+				// The new connection failed after replacing this one, its
+				// read loop takes care of the disconnect
+				conn.Close()
+				return
+			}
+			if err == ErrNotConnected {
+				// Disconnected or draining while dialing
+				return
+			}
+			c.errorLog.log(c.logger.Error, "Cycling connection failed, keeping the current one", F("error", err))
+			continue
+		}
+		if err := c.sendThings(); err != nil {
+			c.logger.Error("Error sending things", F("error", err))
+		}
+		conn.Close()
+		return
+	}
+}
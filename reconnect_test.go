@@ -0,0 +1,265 @@
+package sdk
+
+import (
+	"context"
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAutoReconnect(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url, WithAutoReconnect(3, 10*time.Millisecond, 50*time.Millisecond))
+	attempts := make(chan int, 10)
+	client.OnReconnectAttempt = func(attempt int, nextDelay time.Duration, lastErr error) {
+		attempts <- attempt
+	}
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+	server.Close()
+
+	select {
+	case server = <-conns:
+	case <-time.After(time.Second):
+		t.Fatal("Client did not reconnect")
+	}
+	assert.NotNil(server.readClientMessage(t).GetHello())
+	assert.Equal(1, <-attempts)
+	assert.True(client.IsConnected())
+	assert.Equal(1, client.Status().ReconnectAttempts)
+}
+
+func TestAutoReconnectGivesUp(t *testing.T) {
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	client, _ := NewClient("tcp://"+listener.Addr().String(), WithAutoReconnect(2, time.Millisecond, time.Millisecond))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	gaveUp := 0
+	client.OnReconnectFailed = func(attempts int, lastErr error) {
+		gaveUp = attempts
+		assert.Error(lastErr)
+		wg.Done()
+	}
+	assert.Nil(client.Connect("unit", "token"))
+	conn, err := listener.Accept()
+	assert.Nil(err)
+	listener.Close()
+	conn.Close()
+
+	wg.Wait()
+	assert.Equal(2, gaveUp)
+	assert.False(client.IsConnected())
+}
+
+func TestMaxConnectionAgeCyclesConnection(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url, WithMaxConnectionAge(100*time.Millisecond))
+	disconnects := int32(0)
+	client.OnDisconnect = func() {
+		atomic.AddInt32(&disconnects, 1)
+	}
+	assert.Nil(client.Abstract(newTestThing("thing1")))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	first := <-conns
+	assert.NotNil(first.readClientMessage(t).GetHello())
+
+	second := <-conns
+	assert.NotNil(second.readClientMessage(t).GetHello())
+	assert.Len(second.readClientMessage(t).GetRequestThingsResponse().GetThings(), 1)
+	_, err := first.reader.ReadByte()
+	assert.Equal(io.EOF, err)
+	assert.True(client.IsConnected())
+	assert.Equal(int32(0), atomic.LoadInt32(&disconnects))
+}
+
+func TestConnectionState(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url, WithAutoReconnect(0, time.Minute, time.Minute))
+	assert.Equal(Disconnected, client.ConnectionState())
+	assert.Nil(client.Connect("unit", "token"))
+	assert.Equal(Connected, client.ConnectionState())
+
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+	server.Close()
+	waitFor(func() bool { return client.ConnectionState() == Reconnecting })
+	assert.Equal(Reconnecting, client.ConnectionState())
+	assert.False(client.IsConnected())
+
+	client.Disconnect()
+	waitFor(func() bool { return client.ConnectionState() == Disconnected })
+	assert.Equal(Disconnected, client.ConnectionState())
+	assert.Equal("DISCONNECTED", client.ConnectionState().String())
+}
+
+func TestCycledConnectionHandlesOneMessageAtATime(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url)
+	var active, maxActive int32
+	thing := newTestThing("thing1")
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{Name: "slow", Execute: func(action Action, params []string) error {
+			n := atomic.AddInt32(&active, 1)
+			if n > atomic.LoadInt32(&maxActive) {
+				atomic.StoreInt32(&maxActive, n)
+			}
+			time.Sleep(50 * time.Millisecond)
+			atomic.AddInt32(&active, -1)
+			return nil
+		}},
+	}
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	first := <-conns
+	assert.NotNil(first.readClientMessage(t).GetHello())
+
+	// Replace the connection the way cycling does, with the first one
+	// still open
+	assert.Nil(client.connect(context.Background(), "unit", "token", false, nil))
+	second := <-conns
+	assert.NotNil(second.readClientMessage(t).GetHello())
+
+	thingId, componentId, actionName := "thing1", "main", "slow"
+	for i, server := range []*testServerConn{first, second} {
+		sequence := uint64(i + 1)
+		server.writeServerMessage(t, &protocol.ServerMessage{Action: &protocol.ServerMessage_Execute{
+			Sequence: &sequence,
+			Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+		}})
+	}
+	assert.NotNil(second.readClientMessage(t).GetExecutionResult())
+	assert.NotNil(second.readClientMessage(t).GetExecutionResult())
+	first.Close()
+	assert.Equal(int32(1), atomic.LoadInt32(&maxActive))
+}
+
+func TestDisconnectWhileDialing(t *testing.T) {
+	assert := assert.New(t)
+
+	dialing := make(chan struct{})
+	release := make(chan struct{})
+	server, conn := net.Pipe()
+	client, _ := NewClient("tcp://127.0.0.1:0", WithDialer(func(ctx context.Context) (net.Conn, error) {
+		close(dialing)
+		<-release
+		return conn, nil
+	}))
+	result := make(chan error, 1)
+	go func() {
+		result <- client.Connect("unit", "token")
+	}()
+
+	<-dialing
+	client.Disconnect()
+	close(release)
+	assert.Equal(ErrNotConnected, <-result)
+	assert.False(client.IsConnected())
+	assert.Equal(Disconnected, client.ConnectionState())
+	// The dialed connection is closed instead of being used
+	_, err := server.Read(make([]byte, 1))
+	assert.Equal(io.EOF, err)
+	waitFor(func() bool { return client.Goroutines() == 0 })
+}
+
+func TestFailedCycleKeepsConnection(t *testing.T) {
+	assert := assert.New(t)
+
+	server, conn := net.Pipe()
+	go io.Copy(io.Discard, server)
+	defer server.Close()
+	dials := int32(0)
+	client, _ := NewClient("tcp://127.0.0.1:0", WithMaxConnectionAge(20*time.Millisecond), WithDialer(func(ctx context.Context) (net.Conn, error) {
+		if atomic.AddInt32(&dials, 1) == 1 {
+			return conn, nil
+		}
+		return nil, io.ErrUnexpectedEOF
+	}))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+
+	waitFor(func() bool { return atomic.LoadInt32(&dials) > 2 })
+	assert.True(client.IsConnected())
+	assert.Nil(client.Status().LastError)
+}
+
+func TestDisconnectWhileCycling(t *testing.T) {
+	assert := assert.New(t)
+
+	dialing := make(chan struct{})
+	release := make(chan struct{})
+	first, firstConn := net.Pipe()
+	go io.Copy(io.Discard, first)
+	defer first.Close()
+	second, secondConn := net.Pipe()
+	dials := int32(0)
+	client, _ := NewClient("tcp://127.0.0.1:0", WithMaxConnectionAge(20*time.Millisecond), WithDialer(func(ctx context.Context) (net.Conn, error) {
+		if atomic.AddInt32(&dials, 1) == 1 {
+			return firstConn, nil
+		}
+		close(dialing)
+		<-release
+		return secondConn, nil
+	}))
+	assert.Nil(client.Connect("unit", "token"))
+
+	<-dialing
+	client.Disconnect()
+	close(release)
+	// The connection dialed for the cycle is closed instead of being used
+	_, err := second.Read(make([]byte, 1))
+	assert.Equal(io.EOF, err)
+	assert.False(client.IsConnected())
+	waitFor(func() bool { return client.Goroutines() == 0 })
+}
+
+func TestReconnectErrorsAreThrottled(t *testing.T) {
+	assert := assert.New(t)
+
+	server, conn := net.Pipe()
+	go io.Copy(io.Discard, server)
+	dials := int32(0)
+	logger := &recordingLogger{}
+	client, _ := NewClient("tcp://127.0.0.1:0", WithLogger(logger), WithAutoReconnect(3, time.Millisecond, time.Millisecond),
+		WithDialer(func(ctx context.Context) (net.Conn, error) {
+			if atomic.AddInt32(&dials, 1) == 1 {
+				return conn, nil
+			}
+			return nil, io.ErrUnexpectedEOF
+		}))
+	gaveUp := make(chan struct{})
+	client.OnReconnectFailed = func(attempts int, lastErr error) { close(gaveUp) }
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+
+	server.Close()
+	<-gaveUp
+	failures := 0
+	for _, line := range logger.lines {
+		if strings.HasPrefix(line, "Reconnect attempt failed") {
+			failures++
+		}
+	}
+	assert.Equal(1, failures)
+}
@@ -0,0 +1,64 @@
+package sdk
+
+import (
+	"github.com/connctd/sdk-go/protocol"
+	"time"
+)
+
+const (
+	defaultResultRetention = time.Minute
+	maxUndeliveredResults  = 100
+)
+
+// undeliveredResult is an execution result which could not be sent
+type undeliveredResult struct {
+	result   *protocol.ClientMessage_ExecutionResult
+	failedAt time.Time
+}
+
+// sendResult sends the result of an action. If sending fails, for example
+// because the connection dropped while the action was running, the result
+// is kept and sent again once the server accepted a new connection.
+//
+// Results are delivered at least once: a result whose write failed may
+// still have reached the server partially and is sent again. Results
+// older than the retention set via WithResultRetention are dropped and
+// logged instead, the server has most likely given up on them.
+func (c *Client) sendResult(result *protocol.ClientMessage_ExecutionResult) {
+	err := c.send(&protocol.ClientMessage{ExecutionResult: result})
+	if err == nil || c.resultRetention <= 0 || c.IsConnected() {
+		// Errors on a working connection, like an oversized message,
+		// would fail again
+		return
+	}
+	c.stateLock.Lock()
+	var dropped *protocol.ClientMessage_ExecutionResult
+	if len(c.undeliveredResults) >= maxUndeliveredResults {
+		dropped = c.undeliveredResults[0].result
+		c.undeliveredResults = c.undeliveredResults[1:]
+	}
+	c.undeliveredResults = append(c.undeliveredResults, undeliveredResult{result: result, failedAt: time.Now()})
+	c.stateLock.Unlock()
+	// Logging may block, so it happens after releasing the lock
+	if dropped != nil {
+		c.logger.Error("Dropping undelivered action result", F("sequence", dropped.GetSequence()),
+			F("reason", "too many undelivered results"))
+	}
+}
+
+// resendResults sends the results which could not be delivered over a
+// previous connection
+func (c *Client) resendResults() {
+	c.stateLock.Lock()
+	pending := c.undeliveredResults
+	c.undeliveredResults = nil
+	c.stateLock.Unlock()
+	for _, undelivered := range pending {
+		if time.Since(undelivered.failedAt) > c.resultRetention {
+			c.logger.Error("Dropping stale action result", F("sequence", undelivered.result.GetSequence()),
+				F("result", undelivered.result.GetResult()), F("failedAt", undelivered.failedAt))
+			continue
+		}
+		c.sendResult(undelivered.result)
+	}
+}
@@ -0,0 +1,119 @@
+package sdk
+
+import (
+	"context"
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/connctd/sdk-go/testutil"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResendUndeliveredResults(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	recorder := &recordingLogger{}
+	// The first connection goes to a recorder and breaks, the second one to
+	// the test server
+	broken := &failingConn{}
+	dials := int32(0)
+	client, _ := NewClient(url, WithLogger(recorder), WithDialer(func(ctx context.Context) (net.Conn, error) {
+		if atomic.AddInt32(&dials, 1) == 1 {
+			recorded, err := testutil.NewRecorder().Dial(ctx)
+			broken.Conn = recorded
+			return broken, err
+		}
+		return net.Dial("tcp", strings.TrimPrefix(url, "tcp://"))
+	}))
+	thing := newTestThing("thing1")
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{
+			Name:    "reboot",
+			Execute: func(action Action, params []string) error { return nil },
+		},
+	}
+	assert.Nil(client.Abstract(thing))
+
+	assert.Nil(client.Connect("unit", "token"))
+
+	// The connection breaks while the actions are running
+	atomic.StoreInt32(&broken.broken, 1)
+	thingId, componentId, actionName := "thing1", "main", "reboot"
+	for _, sequence := range []uint64{1, 2} {
+		seq := sequence
+		client.handleAction(&protocol.ServerMessage_Execute{
+			Sequence: &seq,
+			Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+		}, time.Now())
+	}
+	assert.False(client.IsConnected())
+	client.stateLock.Lock()
+	assert.Len(client.undeliveredResults, 2)
+	client.undeliveredResults[0].failedAt = time.Now().Add(-time.Hour)
+	client.stateLock.Unlock()
+
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+	connected := true
+	server.writeServerMessage(t, &protocol.ServerMessage{Hello: &protocol.ServerMessage_ServerHello{Connected: &connected}})
+
+	result := server.readClientMessage(t).GetExecutionResult()
+	assert.Equal(uint64(2), result.GetSequence())
+	assert.Equal(protocol.ClientMessage_ExecutionResult_SUCCESS, result.GetResult())
+	client.stateLock.Lock()
+	assert.Len(client.undeliveredResults, 0)
+	client.stateLock.Unlock()
+}
+
+func TestResultRetentionDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234", WithResultRetention(0))
+	sequence := uint64(1)
+	status := protocol.ClientMessage_ExecutionResult_SUCCESS
+	client.sendResult(&protocol.ClientMessage_ExecutionResult{Sequence: &sequence, Result: &status})
+	assert.Len(client.undeliveredResults, 0)
+}
+
+// statusLogger reads the client status whenever an error is logged, which
+// deadlocks if the client logs while holding its state lock
+type statusLogger struct {
+	client *Client
+	errors []string
+}
+
+func (l *statusLogger) Debug(msg string, fields ...Field) {}
+func (l *statusLogger) Info(msg string, fields ...Field)  {}
+func (l *statusLogger) Error(msg string, fields ...Field) {
+	l.client.Status()
+	l.errors = append(l.errors, msg)
+}
+
+func TestDroppingResultLogsOutsideStateLock(t *testing.T) {
+	assert := assert.New(t)
+
+	logger := &statusLogger{}
+	client, _ := NewClient("tcp://localhost:1234", WithStructuredLogger(logger))
+	logger.client = client
+	status := protocol.ClientMessage_ExecutionResult_SUCCESS
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i <= maxUndeliveredResults; i++ {
+			sequence := uint64(i)
+			client.sendResult(&protocol.ClientMessage_ExecutionResult{Sequence: &sequence, Result: &status})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Logging a dropped result deadlocked")
+	}
+	assert.Equal([]string{"Dropping undelivered action result"}, logger.errors)
+}
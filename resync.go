@@ -0,0 +1,45 @@
+package sdk
+
+// Resync sends the full thing list under a fresh update lock, followed by a
+// property change for every property which has a value, so a server whose
+// view of the device got out of sync recovers without a reconnect.
+// protocol v1 has no message for the server to request a resync, so the
+// application has to trigger it, for example after an out of band signal.
+func (c *Client) Resync() error {
+	if err := c.sendThings(); err != nil {
+		return err
+	}
+	for _, property := range c.capabilityProperties() {
+		if err := property.resend(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// capabilityProperties returns the properties of all capabilities of the
+// abstracted things. Properties of components have no capability to build
+// their path from, so they can't be sent individually.
+func (c *Client) capabilityProperties() []*Property {
+	c.thingsLock.Lock()
+	defer c.thingsLock.Unlock()
+	properties := make([]*Property, 0)
+	for _, thing := range c.things {
+		for _, component := range thing.Components {
+			for _, capability := range component.Capabilities {
+				properties = append(properties, capability.Properties...)
+			}
+		}
+	}
+	return properties
+}
+
+// resend sends the current value of the property again, if it has one
+func (p *Property) resend() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.Value.Value == "" {
+		return nil
+	}
+	return p.sendValue(p.Value.Value)
+}
@@ -0,0 +1,31 @@
+package sdk
+
+import (
+	"github.com/connctd/sdk-go/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestResync(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := testutil.NewRecorder()
+	client, _ := NewClient("tcp://test", WithDialer(recorder.Dial))
+	thing1, thing2 := newTestThing("thing1"), newTestThing("thing2")
+	assert.Nil(client.Abstract(thing1, thing2))
+	assert.Equal(ErrNotConnected, client.Resync())
+
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	assert.Nil(thing1.Components[0].Capabilities[0].Properties[0].Update("21"))
+	before := len(recorder.Messages())
+	lock := client.updateCounter
+
+	assert.Nil(client.Resync())
+	messages := recorder.Messages()[before:]
+	assert.Len(messages, 2)
+	assert.Equal(lock+1, messages[0].GetRequestThingsResponse().GetUpdateLock())
+	assert.Len(messages[0].GetRequestThingsResponse().GetThings(), 2)
+	assert.Equal("thing1", messages[1].GetPropertyChange().GetPath().GetThingId())
+	assert.Equal("21", messages[1].GetPropertyChange().GetValue().GetValue())
+}
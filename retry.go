@@ -0,0 +1,59 @@
+package sdk
+
+import (
+	"errors"
+	"time"
+)
+
+// writeError marks an error writing to the connection. The connection is
+// closed after it, but a new connection may succeed.
+type writeError struct {
+	err error
+}
+
+func (e *writeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *writeError) Unwrap() error {
+	return e.err
+}
+
+// transientSendError reports whether sending may succeed if retried. Write
+// errors and missing connections are transient if the client was connected
+// before and not disconnected on purpose, so the connection may come back.
+// Everything else, like oversized messages, fails the same way again.
+func (c *Client) transientSendError(err error) bool {
+	var writeErr *writeError
+	if !errors.As(err, &writeErr) && err != ErrNotConnected {
+		return false
+	}
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	return c.unitId != "" && !c.closed
+}
+
+// retriesSend reports whether a send which failed with err is retried
+func (c *Client) retriesSend(err error) bool {
+	return c.sendRetries > 0 && c.transientSendError(err)
+}
+
+// retrySend calls send again after it failed with err, until it succeeds,
+// fails permanently or the retries configured via WithPropertySendRetries
+// are used up. The caller must not hold locks, the delays between the
+// attempts are cut short when the application disconnects.
+func (c *Client) retrySend(err error, send func() error) error {
+	for attempt := 1; err != nil && attempt <= c.sendRetries && c.transientSendError(err); attempt++ {
+		c.logger.Info("Retrying failed send", F("attempt", attempt), F("error", err))
+		c.stateLock.Lock()
+		stop := c.stop
+		c.stateLock.Unlock()
+		select {
+		case <-stop:
+			return err
+		case <-time.After(c.sendRetryDelay):
+		}
+		err = send()
+	}
+	return err
+}
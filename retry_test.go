@@ -0,0 +1,104 @@
+package sdk
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPropertySendRetries(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url, WithAutoReconnect(3, 10*time.Millisecond, 10*time.Millisecond),
+		WithPropertySendRetries(50, 10*time.Millisecond))
+	thing := newTestThing("thing1")
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+	server.Close()
+	waitFor(func() bool { return !client.IsConnected() })
+
+	property := thing.Components[0].Capabilities[0].Properties[0]
+	assert.Nil(property.Update("21"))
+	server = <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+}
+
+func TestPropertySendRetriesSkipPermanentErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234", WithPropertySendRetries(3, time.Second))
+	thing := newTestThing("thing1")
+	assert.Nil(client.Abstract(thing))
+
+	// Never connected
+	start := time.Now()
+	assert.Equal(ErrNotConnected, thing.Components[0].Capabilities[0].Properties[0].Update("1"))
+	assert.True(time.Since(start) < time.Second)
+
+	client.setCredentials("unit", "token")
+	attempts := 0
+	permanent := errors.New("Invalid message")
+	assert.Equal(permanent, client.retrySend(permanent, func() error {
+		attempts++
+		return permanent
+	}))
+	assert.Equal(0, attempts)
+
+	client.sendRetryDelay = time.Millisecond
+	attempts = 0
+	assert.Nil(client.retrySend(&writeError{err: errors.New("broken pipe")}, func() error {
+		attempts++
+		if attempts < 2 {
+			return &writeError{err: errors.New("broken pipe")}
+		}
+		return nil
+	}))
+	assert.Equal(2, attempts)
+}
+
+func TestPropertySendRetriesDontBlockTheProperty(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234", WithPropertySendRetries(3, time.Hour))
+	thing := newTestThing("thing1")
+	assert.Nil(client.Abstract(thing))
+	property := thing.Components[0].Capabilities[0].Properties[0]
+	// Connected before, so the missing connection is transient
+	client.setCredentials("unit", "token")
+
+	retried := make(chan error, 1)
+	go func() { retried <- property.Update("1") }()
+	// The retry waits without holding the property lock
+	locked := make(chan bool)
+	go func() {
+		for {
+			property.lock.Lock()
+			value := property.Value.Value
+			property.lock.Unlock()
+			if value == "1" {
+				locked <- true
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("The property stayed locked during the retry")
+	}
+
+	// Disconnect cuts the wait short
+	client.Disconnect()
+	select {
+	case err := <-retried:
+		assert.Equal(ErrNotConnected, err)
+	case <-time.After(time.Second):
+		t.Fatal("Retry did not stop on Disconnect")
+	}
+}
@@ -0,0 +1,103 @@
+package sdk
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Schema describes which properties and actions the platform expects from
+// components of a certain type. Protocol version 1 has no message to
+// deliver a schema, so it has to be provided via Client.SetSchema.
+type Schema struct {
+	ComponentTypes map[string]ComponentSchema
+}
+
+// ComponentSchema lists the properties with their types and the actions a
+// component of a type has to provide
+type ComponentSchema struct {
+	Properties map[string]ValueType
+	Actions    []string
+}
+
+// SchemaErrors lists all mismatches between the abstracted things and the
+// schema
+type SchemaErrors []string
+
+func (e SchemaErrors) Error() string {
+	return "Things do not match schema: " + strings.Join(e, "; ")
+}
+
+// SetSchema sets the schema used by ValidateAgainstSchema
+func (c *Client) SetSchema(schema *Schema) {
+	c.thingsLock.Lock()
+	c.schema = schema
+	c.thingsLock.Unlock()
+}
+
+// ValidateAgainstSchema checks that all components of the abstracted things
+// provide the properties and actions required for their component type.
+// Components with a type not described by the schema are not checked.
+func (c *Client) ValidateAgainstSchema() error {
+	c.thingsLock.Lock()
+	defer c.thingsLock.Unlock()
+	if c.schema == nil {
+		return fmt.Errorf("No schema set")
+	}
+	var errs SchemaErrors
+	for _, thing := range c.things {
+		for _, component := range thing.Components {
+			componentSchema, ok := c.schema.ComponentTypes[component.ComponentType]
+			if !ok {
+				continue
+			}
+			errs = append(errs, validateComponentSchema(thing, component, componentSchema)...)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateComponentSchema(thing *Thing, component *Component, schema ComponentSchema) SchemaErrors {
+	var errs SchemaErrors
+	properties := make(map[string]*Property)
+	actions := make(map[string]bool)
+	for _, property := range component.Properties {
+		properties[property.Name] = property
+	}
+	for _, action := range component.Actions {
+		actions[action.Name] = true
+	}
+	for _, capability := range component.Capabilities {
+		for _, property := range capability.Properties {
+			properties[property.Name] = property
+		}
+		for _, action := range capability.Actions {
+			actions[action.Name] = true
+		}
+	}
+	// Sorted, so the errors are reported in the same order every time
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		valueType := schema.Properties[name]
+		property, ok := properties[name]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s/%s is missing property %s", thing.Id, component.Id, name))
+		} else if property.Value != nil && property.Value.Type != valueType {
+			errs = append(errs, fmt.Sprintf("%s/%s property %s is %s instead of %s",
+				thing.Id, component.Id, name, property.Value.Type, valueType))
+		}
+	}
+	for _, name := range schema.Actions {
+		if !actions[name] {
+			errs = append(errs, fmt.Sprintf("%s/%s is missing action %s", thing.Id, component.Id, name))
+		}
+	}
+	return errs
+}
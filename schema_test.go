@@ -0,0 +1,34 @@
+package sdk
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidateAgainstSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234")
+	assert.Error(client.ValidateAgainstSchema())
+	assert.Nil(client.Abstract(newTestThing("thing1")))
+
+	client.SetSchema(&Schema{ComponentTypes: map[string]ComponentSchema{
+		"sensor": {Properties: map[string]ValueType{"value": Number}},
+	}})
+	assert.Nil(client.ValidateAgainstSchema())
+
+	client.SetSchema(&Schema{ComponentTypes: map[string]ComponentSchema{
+		"sensor": {
+			Properties: map[string]ValueType{"value": String, "battery": Number},
+			Actions:    []string{"calibrate"},
+		},
+	}})
+	err := client.ValidateAgainstSchema()
+	schemaErrs, ok := err.(SchemaErrors)
+	assert.True(ok)
+	assert.Equal(SchemaErrors{
+		"thing1/main is missing property battery",
+		"thing1/main property value is NUMBER instead of STRING",
+		"thing1/main is missing action calibrate",
+	}, schemaErrs)
+}
@@ -0,0 +1,137 @@
+package sdk
+
+import (
+	"github.com/connctd/sdk-go/protocol"
+	"sync"
+	"sync/atomic"
+)
+
+// QueuePolicy decides what happens to property updates when the send queue
+// is full
+type QueuePolicy byte
+
+const (
+	// BlockWhenFull blocks the update until there is room in the queue
+	BlockWhenFull QueuePolicy = iota
+	// DropOldest drops the oldest queued update to make room for the new
+	// one, for devices where fresh values matter more than completeness
+	DropOldest
+	// DropNewest drops the new update
+	DropNewest
+)
+
+const (
+	// MetricSendDropped counts property updates dropped by the send queue
+	MetricSendDropped = "send.dropped"
+)
+
+// sendQueue buffers property updates in front of send, so producers don't
+// wait for a slow link. A worker goroutine sends the queued updates in
+// order, it only exists while updates are queued. A queued change is
+// replaced by a newer change of the same property, only the newest value
+// matters.
+type sendQueue struct {
+	lock    *sync.Mutex
+	notFull *sync.Cond
+	size    int
+	policy  QueuePolicy
+	pending []queuedChange
+	running bool
+	// sending is set while the worker writes a change taken from pending
+	sending bool
+}
+
+// queuedChange is a property change waiting in the send queue
+type queuedChange struct {
+	property *Property
+	msg      *protocol.ClientMessage
+}
+
+func newSendQueue(size int, policy QueuePolicy) *sendQueue {
+	lock := &sync.Mutex{}
+	return &sendQueue{
+		lock:    lock,
+		notFull: sync.NewCond(lock),
+		size:    size,
+		policy:  policy,
+	}
+}
+
+func (q *sendQueue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.pending)
+}
+
+// unsent returns the number of changes not written yet
+func (q *sendQueue) unsent() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.sending {
+		return len(q.pending) + 1
+	}
+	return len(q.pending)
+}
+
+// sendPropertyChange sends a property change, via the send queue if one is
+// configured. Queued changes are sent asynchronously, errors sending them
+// are logged. If the queue drops a change, the property is marked stale, so
+// an update repeating the dropped value is not skipped as unchanged.
+func (c *Client) sendPropertyChange(p *Property, msg *protocol.ClientMessage) error {
+	q := c.sendQueue
+	if q == nil {
+		return c.send(msg)
+	}
+	if !c.IsConnected() {
+		return ErrNotConnected
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for i, queued := range q.pending {
+		if queued.property == p {
+			q.pending[i].msg = msg
+			return nil
+		}
+	}
+	for len(q.pending) >= q.size {
+		switch q.policy {
+		case DropNewest:
+			atomic.StoreInt32(&p.stale, 1)
+			c.metrics.Count(MetricSendDropped, 1, "policy:dropNewest")
+			return nil
+		case DropOldest:
+			atomic.StoreInt32(&q.pending[0].property.stale, 1)
+			q.pending = q.pending[1:]
+			c.metrics.Count(MetricSendDropped, 1, "policy:dropOldest")
+		default:
+			q.notFull.Wait()
+		}
+	}
+	q.pending = append(q.pending, queuedChange{property: p, msg: msg})
+	if !q.running {
+		q.running = true
+		c.spawn("drainSendQueue", c.drainSendQueue)
+	}
+	return nil
+}
+
+func (c *Client) drainSendQueue() {
+	q := c.sendQueue
+	for {
+		q.lock.Lock()
+		q.sending = false
+		if len(q.pending) == 0 {
+			q.running = false
+			q.lock.Unlock()
+			return
+		}
+		msg := q.pending[0].msg
+		q.pending = q.pending[1:]
+		q.sending = true
+		q.notFull.Broadcast()
+		q.lock.Unlock()
+		if err := c.send(msg); err != nil {
+			c.logger.Error("Error sending queued property change", F("error", err))
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"github.com/connctd/sdk-go/testutil"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedConn is a net.Conn to the recorder whose writes block while the
+// gate is closed
+type gatedConn struct {
+	net.Conn
+	lock *sync.Mutex
+	gate chan struct{}
+}
+
+func (c *gatedConn) Write(b []byte) (int, error) {
+	c.lock.Lock()
+	gate := c.gate
+	c.lock.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	return c.Conn.Write(b)
+}
+
+// closeGate blocks all further writes until openGate is called
+func (c *gatedConn) closeGate() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.gate = make(chan struct{})
+}
+
+func (c *gatedConn) openGate() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	close(c.gate)
+	c.gate = nil
+}
+
+// newGatedClient connects a client to a recorder over a gatedConn
+func newGatedClient(t *testing.T, options ...Option) (*Client, *gatedConn, *testutil.Recorder) {
+	recorder := testutil.NewRecorder()
+	conn := &gatedConn{lock: &sync.Mutex{}}
+	options = append(options, WithDialer(func(ctx context.Context) (net.Conn, error) {
+		recorded, err := recorder.Dial(ctx)
+		conn.Conn = recorded
+		return conn, err
+	}))
+	client, _ := NewClient("tcp://localhost:1234", options...)
+	assert.Nil(t, client.Connect("unit", "token"))
+	t.Cleanup(func() { client.Disconnect() })
+	return client, conn, recorder
+}
+
+// propertyValues returns the values of all property changes recorded
+func propertyValues(recorder *testutil.Recorder) []string {
+	values := make([]string, 0)
+	for _, change := range recorder.PropertyChanges() {
+		values = append(values, change.GetValue().GetValue())
+	}
+	return values
+}
+
+func waitFor(condition func() bool) {
+	for i := 0; i < 200 && !condition(); i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// abstractTestProperties abstracts a thing per property, so changes don't
+// replace each other in the send queue
+func abstractTestProperties(t *testing.T, client *Client, count int) []*Property {
+	properties := make([]*Property, 0, count)
+	for i := 0; i < count; i++ {
+		thing := newTestThing(fmt.Sprintf("thing%d", i))
+		assert.Nil(t, client.Abstract(thing))
+		properties = append(properties, thing.Components[0].Capabilities[0].Properties[0])
+	}
+	return properties
+}
+
+func testSendQueuePolicy(t *testing.T, policy QueuePolicy, expected []string) (*Client, *testutil.Recorder, []*Property) {
+	assert := assert.New(t)
+
+	metrics := newRecordingMetrics()
+	client, conn, recorder := newGatedClient(t, WithSendQueue(2, policy), WithMetrics(metrics))
+	properties := abstractTestProperties(t, client, 4)
+	conn.closeGate()
+
+	// The first update blocks the worker on the slow link
+	assert.Nil(properties[0].Update("1"))
+	waitFor(func() bool { return client.sendQueue.len() == 0 })
+	for i, value := range []string{"2", "3", "4"} {
+		assert.Nil(properties[i+1].Update(value))
+	}
+	assert.Equal(2, client.sendQueue.len())
+	assert.Equal(int64(1), metrics.counts[MetricSendDropped])
+
+	conn.openGate()
+	waitFor(func() bool { return client.PendingWrites() == 0 })
+	assert.Equal(expected, propertyValues(recorder))
+	return client, recorder, properties
+}
+
+func TestSendQueueDropOldest(t *testing.T) {
+	client, recorder, properties := testSendQueuePolicy(t, DropOldest, []string{"1", "3", "4"})
+
+	// The dropped value is sent again instead of being skipped as
+	// unchanged
+	assert.Nil(t, properties[1].Update("2"))
+	waitFor(func() bool { return client.PendingWrites() == 0 })
+	assert.Equal(t, []string{"1", "3", "4", "2"}, propertyValues(recorder))
+	assert.Nil(t, properties[2].Update("3"))
+	assert.Equal(t, 0, client.PendingWrites())
+	assert.Equal(t, []string{"1", "3", "4", "2"}, propertyValues(recorder))
+}
+
+func TestSendQueueDropNewest(t *testing.T) {
+	client, recorder, properties := testSendQueuePolicy(t, DropNewest, []string{"1", "2", "3"})
+
+	assert.Nil(t, properties[3].Update("4"))
+	waitFor(func() bool { return client.PendingWrites() == 0 })
+	assert.Equal(t, []string{"1", "2", "3", "4"}, propertyValues(recorder))
+}
+
+func TestSendQueueReplacesQueuedChanges(t *testing.T) {
+	assert := assert.New(t)
+
+	metrics := newRecordingMetrics()
+	client, conn, recorder := newGatedClient(t, WithSendQueue(2, DropNewest), WithMetrics(metrics))
+	properties := abstractTestProperties(t, client, 2)
+	conn.closeGate()
+
+	assert.Nil(properties[0].Update("1"))
+	waitFor(func() bool { return client.sendQueue.len() == 0 })
+	for _, value := range []string{"2", "3", "4"} {
+		assert.Nil(properties[1].Update(value))
+	}
+	assert.Equal(1, client.sendQueue.len())
+	assert.Equal(int64(0), metrics.counts[MetricSendDropped])
+
+	conn.openGate()
+	waitFor(func() bool { return client.PendingWrites() == 0 })
+	assert.Equal([]string{"1", "4"}, propertyValues(recorder))
+}
+
+func TestSendQueueBlockWhenFull(t *testing.T) {
+	assert := assert.New(t)
+
+	url, conns := newTestServer(t)
+	client, _ := NewClient(url, WithSendQueue(1, BlockWhenFull))
+	properties := abstractTestProperties(t, client, 3)
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	server := <-conns
+	assert.NotNil(server.readClientMessage(t).GetHello())
+
+	for i, value := range []string{"1", "2", "3"} {
+		assert.Nil(properties[i].Update(value))
+	}
+	for _, value := range []string{"1", "2", "3"} {
+		assert.Equal(value, server.readClientMessage(t).GetPropertyChange().GetValue().GetValue())
+	}
+}
+
+func TestPendingWrites(t *testing.T) {
+	assert := assert.New(t)
+
+	unqueued, _ := NewClient("tcp://localhost:1234")
+	assert.Equal(0, unqueued.PendingWrites())
+
+	client, conn, recorder := newGatedClient(t, WithSendQueue(4, BlockWhenFull))
+	properties := abstractTestProperties(t, client, 3)
+	conn.closeGate()
+
+	// The first update is taken by the worker and blocks on the slow link
+	assert.Nil(properties[0].Update("1"))
+	waitFor(func() bool { return client.sendQueue.len() == 0 })
+	assert.Equal(1, client.PendingWrites())
+	assert.Nil(properties[1].Update("2"))
+	assert.Nil(properties[2].Update("3"))
+	assert.Equal(3, client.PendingWrites())
+
+	conn.openGate()
+	waitFor(func() bool { return client.PendingWrites() == 0 })
+	assert.Equal(0, client.PendingWrites())
+	assert.Equal([]string{"1", "2", "3"}, propertyValues(recorder))
+}
@@ -0,0 +1,40 @@
+package sdk
+
+// State describes whether the client is connected to the server
+type State byte
+
+const (
+	// Disconnected means there is no connection and none is being
+	// established
+	Disconnected State = iota
+	// Connected means the client is connected to the server
+	Connected
+	// Reconnecting means the connection was lost and the client is trying
+	// to reestablish it
+	Reconnecting
+)
+
+var stateStrings = []string{"DISCONNECTED", "CONNECTED", "RECONNECTING"}
+
+func (s State) String() string {
+	if int(s) >= len(stateStrings) {
+		return "UNKNOWN"
+	}
+	return stateStrings[s]
+}
+
+// ConnectionState returns the state of the connection. Unlike IsConnected
+// it tells a lost connection which is being reestablished apart from a
+// client which is down.
+func (c *Client) ConnectionState() State {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	switch {
+	case c.connected:
+		return Connected
+	case c.reconnecting:
+		return Reconnecting
+	default:
+		return Disconnected
+	}
+}
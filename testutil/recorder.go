@@ -0,0 +1,234 @@
+// Package testutil provides test doubles for applications built on the SDK
+package testutil
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/golang/protobuf/proto"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// errNotDialed is returned when using the recorder before the client
+// dialed it
+var errNotDialed = errors.New("The client did not dial the recorder yet")
+
+// FrameCodec frames the messages exchanged with the client. It has the
+// method set of sdk.FrameCodec, so the codec passed to sdk.WithFrameCodec
+// can be passed to NewRecorderWithCodec as well.
+type FrameCodec interface {
+	WriteFrame(w io.Writer, payload []byte) error
+	ReadFrame(r io.Reader) ([]byte, error)
+}
+
+// varintCodec is the default framing of the SDK, a uvarint length prefix
+type varintCodec struct{}
+
+func (varintCodec) WriteFrame(w io.Writer, payload []byte) error {
+	lenBytes := make([]byte, binary.MaxVarintLen64)
+	lenLength := binary.PutUvarint(lenBytes, uint64(len(payload)))
+	_, err := w.Write(append(lenBytes[:lenLength], payload...))
+	return err
+}
+
+func (varintCodec) ReadFrame(r io.Reader) ([]byte, error) {
+	byteReader, ok := r.(io.ByteReader)
+	if !ok {
+		buffered := bufio.NewReader(r)
+		byteReader, r = buffered, buffered
+	}
+	length, err := binary.ReadUvarint(byteReader)
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// Recorder stands in for the server. It records every ClientMessage the
+// client sends and delivers server messages to it. Pass its Dial method to
+// sdk.WithDialer:
+//
+//	recorder := testutil.NewRecorder()
+//	client, _ := sdk.NewClient("tcp://test", sdk.WithDialer(recorder.Dial))
+//
+// Every dial gets a fresh connection, so reconnects and cycled connections
+// work. Messages are recorded across all connections, Deliver and Close
+// act on the connection dialed last.
+type Recorder struct {
+	codec FrameCodec
+
+	lock     sync.Mutex
+	messages []*protocol.ClientMessage
+	current  *recorderConn
+	dials    int
+}
+
+// NewRecorder creates a Recorder using the default uvarint framing
+func NewRecorder() *Recorder {
+	return NewRecorderWithCodec(varintCodec{})
+}
+
+// NewRecorderWithCodec creates a Recorder for a client configured with
+// sdk.WithFrameCodec
+func NewRecorderWithCodec(codec FrameCodec) *Recorder {
+	return &Recorder{codec: codec}
+}
+
+// Dial returns a new connection to the recorder
+func (r *Recorder) Dial(ctx context.Context) (net.Conn, error) {
+	reader, writer := io.Pipe()
+	conn := &recorderConn{recorder: r, reader: reader, writer: writer}
+	r.lock.Lock()
+	r.current = conn
+	r.dials++
+	r.lock.Unlock()
+	return conn, nil
+}
+
+// Dials returns how often the client dialed the recorder
+func (r *Recorder) Dials() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.dials
+}
+
+// Deliver sends a server message to the client over the connection dialed
+// last. It blocks until the client read it.
+func (r *Recorder) Deliver(msg *protocol.ServerMessage) error {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	conn := r.currentConn()
+	if conn == nil {
+		return errNotDialed
+	}
+	conn.deliverLock.Lock()
+	defer conn.deliverLock.Unlock()
+	return r.codec.WriteFrame(conn.writer, data)
+}
+
+// Close ends the connection dialed last, the client sees it as disconnect
+func (r *Recorder) Close() error {
+	conn := r.currentConn()
+	if conn == nil {
+		return errNotDialed
+	}
+	return conn.Close()
+}
+
+func (r *Recorder) currentConn() *recorderConn {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.current
+}
+
+// Messages returns all messages sent by the client so far
+func (r *Recorder) Messages() []*protocol.ClientMessage {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]*protocol.ClientMessage(nil), r.messages...)
+}
+
+// LastPropertyChange returns the last property change sent by the client or
+// nil if it didn't send any
+func (r *Recorder) LastPropertyChange() *protocol.ClientMessage_PropertyChange {
+	messages := r.Messages()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if change := messages[i].GetPropertyChange(); change != nil {
+			return change
+		}
+	}
+	return nil
+}
+
+// PropertyChanges returns all property changes sent by the client
+func (r *Recorder) PropertyChanges() []*protocol.ClientMessage_PropertyChange {
+	changes := make([]*protocol.ClientMessage_PropertyChange, 0)
+	for _, msg := range r.Messages() {
+		if change := msg.GetPropertyChange(); change != nil {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// ExecutionResults returns all action results sent by the client
+func (r *Recorder) ExecutionResults() []*protocol.ClientMessage_ExecutionResult {
+	results := make([]*protocol.ClientMessage_ExecutionResult, 0)
+	for _, msg := range r.Messages() {
+		if result := msg.GetExecutionResult(); result != nil {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// recorderConn is a connection dialed by the client. Frames written by the
+// client are decoded and recorded before Write returns.
+type recorderConn struct {
+	recorder    *Recorder
+	buf         bytes.Buffer
+	reader      *io.PipeReader
+	writer      *io.PipeWriter
+	deliverLock sync.Mutex
+}
+
+// Read returns the messages passed to Deliver
+func (c *recorderConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// Write decodes the frames written by the client. The codec reads from a
+// bytes.Reader holding the data written so far, a frame it can't read
+// completely yet is decoded again once more data was written.
+func (c *recorderConn) Write(b []byte) (int, error) {
+	r := c.recorder
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	c.buf.Write(b)
+	for c.buf.Len() > 0 {
+		reader := bytes.NewReader(c.buf.Bytes())
+		data, err := r.codec.ReadFrame(reader)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// Wait for the rest of the frame
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		msg := &protocol.ClientMessage{}
+		if err := proto.Unmarshal(data, msg); err != nil {
+			return 0, err
+		}
+		r.messages = append(r.messages, msg)
+		c.buf.Next(c.buf.Len() - reader.Len())
+	}
+	return len(b), nil
+}
+
+// Close ends the connection, the client sees it as disconnect
+func (c *recorderConn) Close() error {
+	return c.writer.CloseWithError(io.EOF)
+}
+
+func (c *recorderConn) LocalAddr() net.Addr                { return recorderAddr{} }
+func (c *recorderConn) RemoteAddr() net.Addr               { return recorderAddr{} }
+func (c *recorderConn) SetDeadline(t time.Time) error      { return nil }
+func (c *recorderConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *recorderConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type recorderAddr struct{}
+
+func (recorderAddr) Network() string { return "recorder" }
+func (recorderAddr) String() string  { return "recorder" }
@@ -0,0 +1,111 @@
+package testutil_test
+
+import (
+	"encoding/binary"
+	"github.com/connctd/sdk-go"
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/connctd/sdk-go/testutil"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := testutil.NewRecorder()
+	client, _ := sdk.NewClient("tcp://test", sdk.WithDialer(recorder.Dial))
+	executed := make(chan struct{})
+	thing := sdk.NewSimpleThing("lamp1", "Lamp", "state")
+	thing.Components[0].Capabilities[0].Actions = []*sdk.Action{
+		{
+			Name: "toggle",
+			Execute: func(action sdk.Action, params []string) error {
+				close(executed)
+				return nil
+			},
+		},
+	}
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	assert.NotNil(recorder.Messages()[0].GetHello())
+
+	assert.Nil(thing.Components[0].Capabilities[0].Properties[0].Update("on"))
+	change := recorder.LastPropertyChange()
+	assert.Equal("lamp1", change.GetPath().GetThingId())
+	assert.Equal("on", change.GetValue().GetValue())
+
+	thingId, componentId, actionName, sequence := "lamp1", "main", "toggle", uint64(7)
+	assert.Nil(recorder.Deliver(&protocol.ServerMessage{Action: &protocol.ServerMessage_Execute{
+		Sequence: &sequence,
+		Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+	}}))
+	<-executed
+	for i := 0; i < 100 && len(recorder.ExecutionResults()) == 0; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	results := recorder.ExecutionResults()
+	assert.Len(results, 1)
+	assert.Equal(uint64(7), results[0].GetSequence())
+	assert.Equal(protocol.ClientMessage_ExecutionResult_SUCCESS, results[0].GetResult())
+}
+
+// fixedFrameCodec prefixes frames with a 4 byte big endian length
+type fixedFrameCodec struct{}
+
+func (fixedFrameCodec) WriteFrame(w io.Writer, payload []byte) error {
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(payload)))
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+func (fixedFrameCodec) ReadFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header))
+	_, err := io.ReadFull(r, payload)
+	return payload, err
+}
+
+func TestRecorderReconnectWithCodec(t *testing.T) {
+	assert := assert.New(t)
+
+	codec := fixedFrameCodec{}
+	recorder := testutil.NewRecorderWithCodec(codec)
+	client, _ := sdk.NewClient("tcp://test", sdk.WithDialer(recorder.Dial), sdk.WithFrameCodec(codec),
+		sdk.WithAutoReconnect(0, time.Millisecond, time.Millisecond))
+	assert.Nil(client.Abstract(sdk.NewSimpleThing("lamp1", "Lamp", "state")))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	assert.Equal(1, recorder.Dials())
+
+	assert.Nil(recorder.Close())
+	for i := 0; i < 100 && (recorder.Dials() < 2 || !client.IsConnected()); i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(2, recorder.Dials())
+
+	assert.Nil(recorder.Deliver(&protocol.ServerMessage{RequestThings: &protocol.ServerMessage_RequestThings{}}))
+	var response *protocol.ClientMessage_RequestThingsResponse
+	for i := 0; i < 100 && response == nil; i++ {
+		for _, msg := range recorder.Messages() {
+			if msg.GetRequestThingsResponse() != nil {
+				response = msg.GetRequestThingsResponse()
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.NotNil(response)
+	hellos := 0
+	for _, msg := range recorder.Messages() {
+		if msg.GetHello() != nil {
+			hellos++
+		}
+	}
+	assert.Equal(2, hellos)
+}
@@ -1,10 +1,17 @@
 package sdk
 
 import (
+	"errors"
 	"fmt"
 	"github.com/connctd/sdk-go/protocol"
 	"gopkg.in/yaml.v2"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type ValueType byte
@@ -17,6 +24,13 @@ const (
 )
 
 var (
+	// ErrPropertyReadOnly is returned when writing to a property which is
+	// not writable
+	ErrPropertyReadOnly = errors.New("Property is read-only")
+
+	// ValueTypeStrings holds the names of the ValueTypes, including the
+	// registered ones. RegisterValueType replaces it, use ValueType.String
+	// and ValueTypeFromString when types may be registered concurrently.
 	ValueTypeStrings = []string{
 		"BOOLEAN",
 		"STRING",
@@ -47,6 +61,43 @@ type Value struct {
 	Value  string `yaml:",omitempty"`
 }
 
+// NewBoolValue returns a Boolean value. Boolean values can't have a symbol,
+// so symbol has to be empty for the value to pass validation.
+func NewBoolValue(symbol string, v bool) *Value {
+	return &Value{Type: Boolean, Symbol: symbol, Value: strconv.FormatBool(v)}
+}
+
+// NewNumberValue returns a Number value formatted in the default number
+// format, like Property.UpdateNumber does for clients without a custom one
+func NewNumberValue(symbol string, v float64) *Value {
+	return &Value{Type: Number, Symbol: symbol, Value: defaultNumberFormat.format(v)}
+}
+
+// NewStringValue returns a String value
+func NewStringValue(symbol, v string) *Value {
+	return &Value{Type: String, Symbol: symbol, Value: v}
+}
+
+// Validate checks that the value has a known type, that only non boolean
+// values have a symbol and that a set value matches the type
+func (v *Value) Validate() error {
+	if int(v.Type) >= len(valueTypeNames()) {
+		return fmt.Errorf("Unknown ValueType %d", v.Type)
+	}
+	if v.Type.primitive() == Boolean && v.Symbol != "" {
+		return fmt.Errorf("A %s value can not have the symbol %s", v.Type, v.Symbol)
+	}
+	if v.Value != "" {
+		return v.Type.check(v.Value)
+	}
+	return nil
+}
+
+// Protocol converts the value to its protocol representation. Symbol and
+// value are always set, even if empty: both are required fields in protocol
+// version 1 and a message omitting them can not be encoded. For the
+// server an empty value therefore always means an empty string, it never
+// sees an absent one.
 func (v *Value) Protocol() *protocol.Value {
 	return &protocol.Value{
 		ValueType: protocolValueTypeFromValueType(v.Type),
@@ -55,11 +106,78 @@ func (v *Value) Protocol() *protocol.Value {
 	}
 }
 
+// NumberFormat describes how numeric values are emitted. Numbers always
+// leave the SDK with a '.' decimal separator.
+type NumberFormat struct {
+	// DecimalSeparator is the separator used in raw number strings passed
+	// to Property.Update, e.g. ',' for devices reporting "3,14"
+	DecimalSeparator rune
+	// GroupingSeparator is the thousands separator used in raw number
+	// strings, e.g. ',' for "1,234.5". It is stripped before the number is
+	// emitted, 0 means the raw strings have none.
+	GroupingSeparator rune
+	// Precision is the number of decimals emitted, -1 uses the smallest
+	// number of decimals necessary to represent the value exactly
+	Precision int
+}
+
+var defaultNumberFormat = NumberFormat{DecimalSeparator: '.', Precision: -1}
+
+func (f NumberFormat) format(v float64) string {
+	return strconv.FormatFloat(v, 'f', f.Precision, 64)
+}
+
+// normalize converts a raw number string into the canonical form. Strings
+// which are not parseable as number are returned unchanged.
+func (f NumberFormat) normalize(raw string) string {
+	canonical := strings.TrimSpace(raw)
+	if f.GroupingSeparator != 0 {
+		canonical = strings.Replace(canonical, string(f.GroupingSeparator), "", -1)
+	}
+	if f.DecimalSeparator != 0 && f.DecimalSeparator != '.' {
+		canonical = strings.Replace(canonical, string(f.DecimalSeparator), ".", 1)
+	}
+	v, err := strconv.ParseFloat(canonical, 64)
+	if err != nil {
+		return raw
+	}
+	if f.Precision < 0 {
+		return canonical
+	}
+	return f.format(v)
+}
+
 type Property struct {
-	Value  *Value
-	Name   string
-	client *Client
-	parent *Capability
+	Value *Value
+	Name  string
+	// TTL is the duration a reported value stays valid. If set, the current
+	// value is re-emitted whenever no update was sent within the TTL, so the
+	// platform never considers it stale. Re-emitting stops when the thing is
+	// removed or the client disconnected. protocol v1 has no field for it.
+	TTL time.Duration `yaml:",omitempty"`
+	// Retained marks the value as one the platform should keep after the
+	// device disconnects. protocol v1 has no field for it.
+	Retained bool `yaml:",omitempty"`
+	// Writable marks properties the platform may set, like the state of an
+	// actuator. All other properties are only reported by the device.
+	Writable bool `yaml:",omitempty"`
+	// OnWrite applies a write to a writable property to the device
+	OnWrite func(p *Property, value string) error `yaml:"-"`
+	client  *Client
+	parent  *Capability
+
+	lock         sync.Mutex
+	refreshTimer *time.Timer
+	debounce     *debounce
+	deadband     func(old, new string) bool
+	// stale is set atomically when the send queue dropped the last change,
+	// so the next update is sent even if it repeats the current value
+	stale int32
+}
+
+// Client returns the client the property was abstracted on
+func (p *Property) Client() *Client {
+	return p.client
 }
 
 func (p *Property) Protocol() *protocol.Property {
@@ -69,33 +187,259 @@ func (p *Property) Protocol() *protocol.Property {
 	}
 }
 
+// Update sends a changed value to the server. The property is addressed
+// by thing Id, component Id and property name, the capability is not part
+// of the path. Property names are therefore unique per component, which is
+// enforced when abstracting things unless collisions are allowed.
 func (p *Property) Update(newValue string) error {
+	if p.Value.Type == Number {
+		newValue = p.numberFormat().normalize(newValue)
+	}
+	if p.strictValues() || valueCodec(p.Value.Type) != nil {
+		if err := p.Value.Type.check(newValue); err != nil {
+			return fmt.Errorf("Invalid value for property %s of type %s: %v", p.Name, p.Value.Type, err)
+		}
+	}
+	if p.debounced(newValue) {
+		return nil
+	}
+	return p.apply(newValue)
+}
+
+// apply sends a validated value and notifies about the change
+func (p *Property) apply(newValue string) error {
+	oldValue, changed, err := p.update(newValue)
+	if err != nil || !changed {
+		return err
+	}
+	if p.client.OnPropertyChanged != nil {
+		p.client.OnPropertyChanged(*p.path(), oldValue, newValue)
+	}
+	return nil
+}
+
+// update sends the new value if it differs from the current one and
+// returns the value it replaced. If sending fails for a transient reason,
+// the value is kept as current and sending is retried without holding the
+// property lock, so other updates are not held up by the retries. A value
+// superseded by a newer update is not retried. If the retries fail, the
+// property is marked stale, so the next update is sent in any case.
+func (p *Property) update(newValue string) (string, bool, error) {
+	p.lock.Lock()
+	oldValue := p.Value.Value
+	stale := atomic.SwapInt32(&p.stale, 0) == 1
 	// Only update if value has changed
-	if p.Value.Value != newValue {
-		path := &protocol.Path{
-			Property:    &p.Name,
-			ComponentId: &p.parent.parent.Id,
-			ThingId:     &p.parent.parent.parent.Id,
+	if oldValue == newValue && !stale {
+		p.lock.Unlock()
+		return oldValue, false, nil
+	}
+	if p.deadband != nil && oldValue != "" && !stale && !p.deadband(oldValue, newValue) {
+		p.lock.Unlock()
+		return oldValue, false, nil
+	}
+	err := p.sendValue(newValue)
+	if err == nil {
+		p.Value.Value = newValue
+		p.scheduleRefresh()
+		p.lock.Unlock()
+		return oldValue, true, nil
+	}
+	if p.client == nil || !p.client.retriesSend(err) {
+		if stale {
+			atomic.StoreInt32(&p.stale, 1)
 		}
-		value := &protocol.Value{
-			Value:     &newValue,
-			ValueType: protocolValueTypeFromValueType(p.Value.Type),
-			Symbol:    &p.Value.Symbol,
+		p.lock.Unlock()
+		return oldValue, false, err
+	}
+	p.Value.Value = newValue
+	atomic.StoreInt32(&p.stale, 1)
+	p.lock.Unlock()
+
+	err = p.client.retrySend(err, func() error {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		if p.Value.Value != newValue {
+			// Superseded, the newer update takes care of sending
+			return nil
 		}
-		propertyChange := &protocol.ClientMessage_PropertyChange{
-			Path:  path,
-			Value: value,
+		if err := p.sendValue(newValue); err != nil {
+			return err
 		}
-		cm := &protocol.ClientMessage{
-			PropertyChange: propertyChange,
+		atomic.StoreInt32(&p.stale, 0)
+		p.scheduleRefresh()
+		return nil
+	})
+	if err != nil {
+		return oldValue, false, err
+	}
+	return oldValue, true, nil
+}
+
+// SetDeadband only lets updates through which significant says are a
+// significant change compared to the last sent value. The first value is
+// always sent. significant is called with the property locked, so it must
+// not use the property. A nil function removes the deadband.
+func (p *Property) SetDeadband(significant func(old, new string) bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.deadband = significant
+}
+
+// SetNumericDeadband only sends updates of a Number property which differ
+// by at least delta from the last sent value. Values which are no numbers
+// are always sent.
+func (p *Property) SetNumericDeadband(delta float64) {
+	p.SetDeadband(func(old, new string) bool {
+		oldNumber, err := strconv.ParseFloat(old, 64)
+		if err != nil {
+			return true
+		}
+		newNumber, err := strconv.ParseFloat(new, 64)
+		if err != nil {
+			return true
+		}
+		return math.Abs(newNumber-oldNumber) >= delta
+	})
+}
+
+// Write applies a value set by the platform. Writes to properties which
+// are not writable are rejected. On success the written value is reported
+// back to the server via Update. Protocol version 1 neither transports the
+// writable flag nor property writes, so integrations receiving writes out
+// of band should route them through Write.
+func (p *Property) Write(value string) error {
+	if !p.Writable {
+		return fmt.Errorf("%w: %s", ErrPropertyReadOnly, p.Name)
+	}
+	if p.OnWrite != nil {
+		if err := p.OnWrite(p, value); err != nil {
+			return err
+		}
+	}
+	return p.Update(value)
+}
+
+// UpdateNumber updates a Number property, formatting the value according
+// to the clients NumberFormat
+func (p *Property) UpdateNumber(v float64) error {
+	return p.Update(p.numberFormat().format(v))
+}
+
+// UpdateBool updates a Boolean property
+func (p *Property) UpdateBool(v bool) error {
+	return p.Update(strconv.FormatBool(v))
+}
+
+// UpdateValue updates a property of a custom ValueType, encoding the value
+// with the codec registered for the type
+func (p *Property) UpdateValue(v interface{}) error {
+	codec := valueCodec(p.Value.Type)
+	if codec == nil {
+		return fmt.Errorf("No codec registered for ValueType %s", p.Value.Type)
+	}
+	encoded, err := codec.Encode(v)
+	if err != nil {
+		return err
+	}
+	return p.Update(encoded)
+}
+
+func (p *Property) numberFormat() NumberFormat {
+	if p.client == nil {
+		return defaultNumberFormat
+	}
+	return p.client.numberFormat
+}
+
+// strictValues reports whether raw values are checked against the ValueType
+func (p *Property) strictValues() bool {
+	return p.client != nil && p.client.strictValues
+}
+
+func (p *Property) path() *protocol.Path {
+	return &protocol.Path{
+		Property:    &p.Name,
+		ComponentId: &p.parent.parent.Id,
+		ThingId:     &p.parent.parent.parent.Id,
+	}
+}
+
+func (p *Property) sendValue(newValue string) error {
+	if p.client == nil {
+		return ErrNotConnected
+	}
+	path := p.path()
+	value := &protocol.Value{
+		Value:     &newValue,
+		ValueType: protocolValueTypeFromValueType(p.Value.Type),
+		Symbol:    &p.Value.Symbol,
+	}
+	propertyChange := &protocol.ClientMessage_PropertyChange{
+		Path:  path,
+		Value: value,
+	}
+	cm := &protocol.ClientMessage{
+		PropertyChange: propertyChange,
+	}
+	return p.client.sendPropertyChange(p, cm)
+}
+
+// scheduleRefresh (re)arms the timer re-emitting the current value after
+// the TTL. Must be called with the property lock held.
+func (p *Property) scheduleRefresh() {
+	if p.TTL <= 0 {
+		return
+	}
+	if p.refreshTimer != nil {
+		p.refreshTimer.Stop()
+	}
+	p.refreshTimer = time.AfterFunc(p.TTL, p.refresh)
+}
+
+func (p *Property) refresh() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.client == nil || !p.client.refreshesProperty(p) {
+		p.refreshTimer = nil
+		return
+	}
+	// Keep the timer running while disconnected, so refreshing resumes
+	// once the connection is back
+	if p.client.IsConnected() {
+		p.sendValue(p.Value.Value)
+	}
+	p.scheduleRefresh()
+}
+
+// stopRefresh stops re-emitting the value until it is updated again
+func (p *Property) stopRefresh() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.refreshTimer != nil {
+		p.refreshTimer.Stop()
+		p.refreshTimer = nil
+	}
+}
+
+// stopRefreshing stops the TTL timers of all properties of the things. It
+// takes the property locks, so it must not be called with thingsLock held.
+func stopRefreshing(things ...*Thing) {
+	for _, thing := range things {
+		for _, component := range thing.Components {
+			for _, property := range component.Properties {
+				property.stopRefresh()
+			}
+			for _, capability := range component.Capabilities {
+				for _, property := range capability.Properties {
+					property.stopRefresh()
+				}
+			}
 		}
-		p.client.send(cm)
 	}
-	return nil
 }
 
 func protocolValueTypeFromValueType(v ValueType) *protocol.ValueType {
-	vt := protocol.ValueType(protocol.ValueType_value[strings.ToUpper(v.String())])
+	vt := protocol.ValueType(protocol.ValueType_value[strings.ToUpper(v.primitive().String())])
 	return &vt
 }
 
@@ -104,18 +448,92 @@ type ActionParameter struct {
 	Name string
 }
 
+// Validate checks that the parameter has a valid name and a type
+func (a *ActionParameter) Validate() error {
+	if !validNameRegexp.MatchString(a.Name) {
+		return fmt.Errorf("%s is an invalid name for a parameter", a.Name)
+	}
+	if a.Type == nil {
+		return fmt.Errorf("Parameter %s has no type", a.Name)
+	}
+	if int(*a.Type) >= len(valueTypeNames()) {
+		return fmt.Errorf("Parameter %s has the unknown ValueType %d", a.Name, *a.Type)
+	}
+	return nil
+}
+
+// Protocol serializes the parameter. Parameters without a type, which
+// Validate rejects, are announced as String like their values are treated
+// when executing the action.
 func (a *ActionParameter) Protocol() *protocol.Action_Parameter {
+	valueType := String
+	if a.Type != nil {
+		valueType = *a.Type
+	}
 	return &protocol.Action_Parameter{
-		ValueType: a.Type.Protocol(),
+		ValueType: valueType.Protocol(),
 		Name:      &a.Name,
 	}
 }
 
 type Action struct {
 	Name       string
-	Parameters []*ActionParameter                         `yaml:",omitempty"`
-	Execute    func(action Action, params []string) error `yaml:"-"`
-	parent     *Capability
+	Parameters []*ActionParameter `yaml:",omitempty"`
+	// Execute handles invocations of the action. The ExecutionResult of
+	// protocol version 1 only carries a status and an error reason, so an
+	// action can not return data to the server.
+	Execute func(action Action, params []string) error `yaml:"-"`
+	parent  *Capability
+	client  *Client
+	// receivedAt is set on the copy passed to Execute
+	receivedAt time.Time
+	// last is allocated when wiring, so copies of the action share it
+	last *actionResult
+}
+
+// actionResult is the outcome of the most recent invocation of an action
+type actionResult struct {
+	lock   sync.Mutex
+	status protocol.ClientMessage_ExecutionResult_Status
+	reason string
+	at     time.Time
+}
+
+// LastResult returns the status and error reason of the most recent result
+// sent for the action and when it was sent. at is zero if the action was
+// not invoked yet.
+func (a Action) LastResult() (status protocol.ClientMessage_ExecutionResult_Status, reason string, at time.Time) {
+	if a.last == nil {
+		return status, reason, at
+	}
+	a.last.lock.Lock()
+	defer a.last.lock.Unlock()
+	return a.last.status, a.last.reason, a.last.at
+}
+
+// recordResult remembers the result sent for an invocation
+func (a *Action) recordResult(status protocol.ClientMessage_ExecutionResult_Status, reason string) {
+	if a.last == nil {
+		return
+	}
+	a.last.lock.Lock()
+	defer a.last.lock.Unlock()
+	a.last.status = status
+	a.last.reason = reason
+	a.last.at = time.Now()
+}
+
+// ReceivedAt returns when the message invoking the action was received
+// from the server. It is only set for the action passed to Execute, so
+// handlers can measure their processing latency.
+func (a Action) ReceivedAt() time.Time {
+	return a.receivedAt
+}
+
+// Client returns the client the action was abstracted on, so handlers
+// shared by several clients can tell them apart, e.g. via Client.UserData
+func (a Action) Client() *Client {
+	return a.client
 }
 
 func (a *Action) Protocol() *protocol.Action {
@@ -153,6 +571,15 @@ func (c *Capability) Protocol() *protocol.Capability {
 	}
 }
 
+func (c *Capability) GetProperty(propertyName string) *Property {
+	for _, property := range c.Properties {
+		if property.Name == propertyName {
+			return property
+		}
+	}
+	return nil
+}
+
 type Component struct {
 	Id            string
 	Name          string
@@ -160,7 +587,18 @@ type Component struct {
 	Capabilities  []*Capability
 	Properties    []*Property `yaml:",omitempty"`
 	Actions       []*Action   `yaml:",omitempty"`
-	parent        *Thing
+	// Links describes how the component relates to other components of the
+	// thing. protocol v1 has no field for it, so links are only part of the
+	// yaml representation.
+	Links  []ComponentLink `yaml:",omitempty"`
+	parent *Thing
+}
+
+// ComponentLink relates a component to another component of the same thing,
+// like a thermostat component which "controls" a heater component
+type ComponentLink struct {
+	Relation string
+	Target   string
 }
 
 func (c *Component) Protocol() *protocol.Component {
@@ -189,26 +627,117 @@ func (c *Component) Protocol() *protocol.Component {
 	}
 }
 
+// GetAction returns the action with the given name, looking at the actions
+// of the component before those of its capabilities. The protocol path has
+// no capability, so with AllowCollisions the first match wins.
 func (c *Component) GetAction(actionName string) *Action {
+	for _, action := range c.Actions {
+		if action.Name == actionName {
+			return action
+		}
+	}
 	for _, capability := range c.Capabilities {
-		for _, action := range capability.Actions {
-			if action.Name == actionName {
-				return action
-			}
+		if action := capability.GetAction(actionName); action != nil {
+			return action
 		}
 	}
 	return nil
 }
 
+// GetAction returns the action of the capability with the given name
+func (c *Capability) GetAction(actionName string) *Action {
+	for _, action := range c.Actions {
+		if action.Name == actionName {
+			return action
+		}
+	}
+	return nil
+}
+
+func (c *Component) GetCapability(capabilityId string) *Capability {
+	for _, capability := range c.Capabilities {
+		if capability.Id == capabilityId {
+			return capability
+		}
+	}
+	return nil
+}
+
+// AddCapabilityLive adds a capability to a component of an abstracted thing,
+// like when a plugin of the device was loaded. The changed thing is
+// validated and, if the client is connected, sent to the server.
+func (c *Component) AddCapabilityLive(capability *Capability) error {
+	client := c.client()
+	if client == nil {
+		return fmt.Errorf("Component %s is not abstracted on a client", c.Id)
+	}
+	client.thingsLock.Lock()
+	if c.GetCapability(capability.Id) != nil {
+		client.thingsLock.Unlock()
+		return fmt.Errorf("The capability with the Id %s already exists in component %s", capability.Id, c.Id)
+	}
+	previous := c.Capabilities
+	c.Capabilities = append(previous[:len(previous):len(previous)], capability)
+	if err := client.validateDefinition(c.parent); err != nil {
+		c.Capabilities = previous
+		client.thingsLock.Unlock()
+		return err
+	}
+	// Only the new capability is wired, actions of the others may be
+	// executing
+	client.wireCapability(c, capability)
+	client.thingsLock.Unlock()
+	return c.parent.pushIfConnected()
+}
+
+// RemoveCapability removes a capability from a component of an abstracted
+// thing and, if the client is connected, sends the changed thing to the
+// server
+func (c *Component) RemoveCapability(capabilityId string) error {
+	client := c.client()
+	if client == nil {
+		return fmt.Errorf("Component %s is not abstracted on a client", c.Id)
+	}
+	client.thingsLock.Lock()
+	capabilities := make([]*Capability, 0, len(c.Capabilities))
+	for _, capability := range c.Capabilities {
+		if capability.Id != capabilityId {
+			capabilities = append(capabilities, capability)
+		}
+	}
+	if len(capabilities) == len(c.Capabilities) {
+		client.thingsLock.Unlock()
+		return fmt.Errorf("The capability with the Id %s does not exist in component %s", capabilityId, c.Id)
+	}
+	c.Capabilities = capabilities
+	client.thingsLock.Unlock()
+	return c.parent.pushIfConnected()
+}
+
+// client returns the client the thing of the component is abstracted on
+func (c *Component) client() *Client {
+	if c.parent == nil || c.parent.client == nil || c.parent.client.getThing(c.parent.Id) != c.parent {
+		return nil
+	}
+	return c.parent.client
+}
+
 type Attribute struct {
 	Name  string
 	Value string
+	// ValueFunc computes the value each time the thing is serialized, for
+	// dynamic attributes like the uptime. It takes precedence over Value.
+	ValueFunc func() string `yaml:"-"`
 }
 
 func (a *Attribute) Protocol() *protocol.Thing_Attribute {
+	value := a.Value
+	if a.ValueFunc != nil {
+		value = a.ValueFunc()
+	}
 	return &protocol.Thing_Attribute{
 		Name:  &a.Name,
-		Value: &a.Value,
+		Value: &value,
 	}
 }
 
@@ -221,14 +750,43 @@ type Thing struct {
 	MaincomponentId string
 	Attributes      []*Attribute `yaml:",omitempty"`
 	ComponentType   string
+	client          *Client
+}
+
+// NewSimpleThing returns a thing with a single main component holding one
+// capability with a string property of the given name. It is meant as a
+// starting point for prototypes and tests.
+func NewSimpleThing(id, name, propertyName string) *Thing {
+	return &Thing{
+		Id:              id,
+		Name:            name,
+		MaincomponentId: "main",
+		Components: []*Component{
+			{
+				Id:   "main",
+				Name: name,
+				Capabilities: []*Capability{
+					{
+						Id: "main",
+						Properties: []*Property{
+							{
+								Name:  propertyName,
+								Value: &Value{Type: String},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
 }
 
 func (v ValueType) String() string {
-	return ValueTypeStrings[v]
+	return valueTypeNames()[v]
 }
 
 func ValueTypeFromString(s string) (ValueType, error) {
-	for i, valueType := range ValueTypeStrings {
+	for i, valueType := range valueTypeNames() {
 		if valueType == s {
 			return ValueType(i), nil
 		}
@@ -247,7 +805,7 @@ func (v ValueType) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return err
 	}
 	found := false
-	for i, name := range ValueTypeStrings {
+	for i, name := range valueTypeNames() {
 		if name == valueTypeString {
 			v = ValueType(i)
 			found = true
@@ -275,6 +833,10 @@ func (t *Thing) Protocol() *protocol.Thing {
 	for _, component := range t.Components {
 		components = append(components, component.Protocol())
 	}
+	// Sort components, so the same thing always serializes identically
+	sort.SliceStable(components, func(i, j int) bool {
+		return components[i].GetId() < components[j].GetId()
+	})
 	thing := &protocol.Thing{
 		Id:              &t.Id,
 		Name:            &t.Name,
@@ -287,6 +849,32 @@ func (t *Thing) Protocol() *protocol.Thing {
 	return thing
 }
 
+// Push sends the current definition and values of the thing to the server,
+// without resending the other things of the client. It fails if the thing
+// is not abstracted on a connected client.
+func (t *Thing) Push() error {
+	if t.client == nil {
+		return fmt.Errorf("Thing %s is not abstracted on a client", t.Id)
+	}
+	t.client.thingsLock.Lock()
+	if t.client.findThing(t.Id) != t {
+		t.client.thingsLock.Unlock()
+		return fmt.Errorf("Thing %s is not abstracted on a client", t.Id)
+	}
+	msg := &protocol.ClientMessage{Thing: t.Protocol()}
+	t.client.thingsLock.Unlock()
+	return t.client.send(msg)
+}
+
+// pushIfConnected pushes the thing unless the client is disconnected, the
+// thing is part of the thing list sent on the next connect anyway
+func (t *Thing) pushIfConnected() error {
+	if !t.client.IsConnected() {
+		return nil
+	}
+	return t.Push()
+}
+
 func (t *Thing) GetComponent(componentId string) *Component {
 	for _, component := range t.Components {
 		if componentId == component.Id {
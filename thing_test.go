@@ -0,0 +1,378 @@
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/connctd/sdk-go/testutil"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNumberFormatNormalize(t *testing.T) {
+	assert := assert.New(t)
+
+	comma := NumberFormat{DecimalSeparator: ',', Precision: -1}
+	assert.Equal("3.14", comma.normalize("3,14"))
+	assert.Equal("42", comma.normalize("42"))
+	assert.Equal("n/a", comma.normalize("n/a"))
+
+	twoDecimals := NumberFormat{DecimalSeparator: ',', Precision: 2}
+	assert.Equal("3.10", twoDecimals.normalize("3,1"))
+	assert.Equal("3.14", twoDecimals.format(3.14159))
+
+	grouped := NumberFormat{DecimalSeparator: '.', GroupingSeparator: ',', Precision: -1}
+	assert.Equal("1234.5", grouped.normalize("1,234.5"))
+	assert.Equal("1234567", grouped.normalize(" 1,234,567 "))
+	german := NumberFormat{DecimalSeparator: ',', GroupingSeparator: '.', Precision: -1}
+	assert.Equal("1234.5", german.normalize("1.234,5"))
+	german.Precision = 2
+	assert.Equal("1234.50", german.normalize("1.234,5"))
+
+	assert.Equal("3.14", defaultNumberFormat.normalize("3.14"))
+	assert.Equal("0.5", defaultNumberFormat.format(0.5))
+}
+
+func TestPropertyWrite(t *testing.T) {
+	assert := assert.New(t)
+
+	sensor := &Property{Name: "temperature", Value: &Value{Type: Number}}
+	assert.True(errors.Is(sensor.Write("1"), ErrPropertyReadOnly))
+
+	var written string
+	actuator := &Property{
+		Name:     "on",
+		Value:    &Value{Type: Boolean, Value: "false"},
+		Writable: true,
+		OnWrite: func(p *Property, value string) error {
+			written = value
+			return nil
+		},
+	}
+	// The confirming update fails since the property isn't abstracted
+	assert.Equal(ErrNotConnected, actuator.Write("true"))
+	assert.Equal("true", written)
+}
+
+func TestThingProtocolSortsComponents(t *testing.T) {
+	assert := assert.New(t)
+
+	thing := &Thing{
+		Id: "thing1",
+		Components: []*Component{
+			{Id: "b"},
+			{Id: "a"},
+			{Id: "c"},
+		},
+	}
+	components := thing.Protocol().GetComponents()
+	assert.Equal("a", components[0].GetId())
+	assert.Equal("b", components[1].GetId())
+	assert.Equal("c", components[2].GetId())
+	// The definition itself keeps its order
+	assert.Equal("b", thing.Components[0].Id)
+}
+
+func TestNewSimpleThing(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234")
+	thing := NewSimpleThing("thing1", "Lamp", "state")
+	assert.Nil(client.Abstract(thing))
+	_, err := proto.Marshal(thing.Protocol())
+	assert.Nil(err)
+	assert.NotNil(thing.Components[0].Capabilities[0].GetProperty("state"))
+	assert.Equal(ErrNotConnected, client.UpdatePropertyByPath("thing1/main/main/state", "on"))
+}
+
+func TestValueValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil((&Value{Type: Number, Symbol: "C", Value: "21.5"}).Validate())
+	assert.Nil((&Value{Type: Boolean}).Validate())
+	assert.Error((&Value{Type: Boolean, Symbol: "C"}).Validate())
+	assert.Error((&Value{Type: Number, Value: "warm"}).Validate())
+	assert.Error((&Value{Type: ValueType(200)}).Validate())
+}
+
+func TestActionParameterValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	number := Number
+	assert.Nil((&ActionParameter{Name: "interval", Type: &number}).Validate())
+	assert.EqualError((&ActionParameter{Name: "interval"}).Validate(), "Parameter interval has no type")
+	assert.Error((&ActionParameter{Type: &number}).Validate())
+
+	client, _ := NewClient("tcp://localhost:1234")
+	thing := newTestThing("thing1")
+	thing.Components[0].Actions = []*Action{{Name: "configure", Parameters: []*ActionParameter{{Name: "interval"}}}}
+	assert.EqualError(client.Abstract(thing), "Action configure: Parameter interval has no type")
+}
+
+func TestActionParameterWithoutTypeProtocol(t *testing.T) {
+	assert := assert.New(t)
+
+	thing := newTestThing("thing1")
+	thing.Components[0].Actions = []*Action{{Name: "configure", Parameters: []*ActionParameter{{Name: "interval"}}}}
+	var parameters []*protocol.Action_Parameter
+	assert.NotPanics(func() {
+		parameters = thing.Protocol().GetComponents()[0].GetActions()[0].GetParameters()
+	})
+	assert.Len(parameters, 1)
+	assert.Equal(protocol.ValueType_STRING, parameters[0].GetValueType())
+}
+
+func TestValueProtocolSetsRequiredFields(t *testing.T) {
+	assert := assert.New(t)
+
+	value := (&Value{Type: String}).Protocol()
+	assert.NotNil(value.Symbol)
+	assert.NotNil(value.Value)
+	_, err := proto.Marshal(value)
+	assert.Nil(err)
+
+	value.Symbol = nil
+	_, err = proto.Marshal(value)
+	assert.Error(err)
+}
+
+func TestNumericDeadband(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := testutil.NewRecorder()
+	client, _ := NewClient("tcp://test", WithDialer(recorder.Dial))
+	thing := newTestThing("thing1")
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+
+	property := thing.Components[0].Capabilities[0].Properties[0]
+	property.SetNumericDeadband(0.5)
+	for _, value := range []string{"20", "20.2", "20.4", "20.5", "20.1", "19.9"} {
+		assert.Nil(property.Update(value))
+	}
+	values := make([]string, 0)
+	for _, change := range recorder.PropertyChanges() {
+		values = append(values, change.GetValue().GetValue())
+	}
+	assert.Equal([]string{"20", "20.5", "19.9"}, values)
+	assert.Equal("19.9", property.Value.Value)
+}
+
+func TestStrictValues(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := testutil.NewRecorder()
+	client, _ := NewClient("tcp://test", WithDialer(recorder.Dial), WithStrictValues())
+	thing := newTestThing("thing1")
+	capability := thing.Components[0].Capabilities[0]
+	capability.Properties = append(capability.Properties,
+		&Property{Name: "on", Value: &Value{Type: Boolean}},
+		&Property{Name: "label", Value: &Value{Type: String}},
+	)
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	number, boolean, str := capability.Properties[0], capability.Properties[1], capability.Properties[2]
+
+	assert.Nil(number.Update("21.5"))
+	assert.Error(number.Update("warm"))
+	assert.Equal("21.5", number.Value.Value)
+
+	assert.Nil(boolean.Update("true"))
+	assert.Error(boolean.Update("on"))
+	assert.Equal("true", boolean.Value.Value)
+
+	assert.Nil(str.Update("anything"))
+	assert.Len(recorder.PropertyChanges(), 3)
+}
+
+func TestLenientValuesByDefault(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := testutil.NewRecorder()
+	client, _ := NewClient("tcp://test", WithDialer(recorder.Dial))
+	thing := newTestThing("thing1")
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+
+	assert.Nil(thing.Components[0].Capabilities[0].Properties[0].Update("warm"))
+	assert.Len(recorder.PropertyChanges(), 1)
+}
+
+func TestThingPush(t *testing.T) {
+	assert := assert.New(t)
+
+	thing := newTestThing("thing1")
+	assert.EqualError(thing.Push(), "Thing thing1 is not abstracted on a client")
+
+	recorder := testutil.NewRecorder()
+	client, _ := NewClient("tcp://test", WithDialer(recorder.Dial))
+	assert.Nil(client.Abstract(thing, newTestThing("thing2")))
+	assert.Equal(ErrNotConnected, thing.Push())
+
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	assert.Nil(thing.Push())
+	messages := recorder.Messages()
+	assert.Equal("thing1", messages[len(messages)-1].GetThing().GetId())
+
+	assert.Nil(client.RemoveThing(thing))
+	assert.Error(thing.Push())
+}
+
+func TestTypedValueConstructors(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(&Value{Type: Boolean, Value: "true"}, NewBoolValue("", true))
+	assert.Equal(&Value{Type: Number, Symbol: "C", Value: "21.5"}, NewNumberValue("C", 21.5))
+	assert.Equal(&Value{Type: Number, Symbol: "%", Value: "100"}, NewNumberValue("%", 100))
+	assert.Equal(&Value{Type: String, Value: "eco"}, NewStringValue("", "eco"))
+	for _, value := range []*Value{NewBoolValue("", false), NewNumberValue("W", 0.25), NewStringValue("", "")} {
+		assert.Nil(value.Validate())
+	}
+	assert.Error(NewBoolValue("on", true).Validate())
+}
+
+func TestAddAndRemoveCapabilityLive(t *testing.T) {
+	assert := assert.New(t)
+
+	component := newTestThing("thing1").Components[0]
+	assert.Error(component.AddCapabilityLive(&Capability{Id: "humidity"}))
+
+	recorder := testutil.NewRecorder()
+	client, _ := NewClient("tcp://test", WithDialer(recorder.Dial))
+	thing := newTestThing("thing1")
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	component = thing.Components[0]
+
+	humidity := &Capability{
+		Id:         "humidity",
+		Properties: []*Property{{Name: "humidity", Value: &Value{Type: Number, Symbol: "%"}}},
+	}
+	assert.Nil(component.AddCapabilityLive(humidity))
+	pushed := recorder.Messages()[len(recorder.Messages())-1].GetThing()
+	assert.Len(pushed.GetComponents()[0].GetCapabilities(), 2)
+	assert.Nil(humidity.Properties[0].Update("40"))
+	assert.Equal("humidity", recorder.LastPropertyChange().GetPath().GetProperty())
+
+	assert.EqualError(component.AddCapabilityLive(&Capability{Id: "humidity"}),
+		"The capability with the Id humidity already exists in component main")
+	// The colliding property name is rejected and the capability not added
+	assert.Error(component.AddCapabilityLive(&Capability{
+		Id:         "other",
+		Properties: []*Property{{Name: "value", Value: &Value{Type: Number}}},
+	}))
+	assert.Len(component.Capabilities, 2)
+
+	assert.Nil(component.RemoveCapability("humidity"))
+	pushed = recorder.Messages()[len(recorder.Messages())-1].GetThing()
+	assert.Len(pushed.GetComponents()[0].GetCapabilities(), 1)
+	assert.Error(component.RemoveCapability("humidity"))
+}
+
+func TestCapabilityChangesWhileExecuting(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := testutil.NewRecorder()
+	client, _ := NewClient("tcp://test", WithDialer(recorder.Dial))
+	thing := newTestThing("thing1")
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{Name: "reset", Execute: func(action Action, params []string) error { return nil }},
+	}
+	assert.Nil(client.Abstract(thing))
+	assert.Nil(client.Connect("unit", "token"))
+	defer client.Disconnect()
+	component := thing.Components[0]
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			component.AddCapabilityLive(&Capability{Id: "humidity"})
+			component.RemoveCapability("humidity")
+		}
+	}()
+	thingId, componentId, actionName := "thing1", "main", "reset"
+	for i := uint64(1); i <= 50; i++ {
+		sequence := i
+		assert.Nil(recorder.Deliver(&protocol.ServerMessage{Action: &protocol.ServerMessage_Execute{
+			Sequence: &sequence,
+			Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+		}}))
+	}
+	waitFor(func() bool { return len(recorder.ExecutionResults()) == 50 })
+	close(stop)
+	<-done
+	for _, result := range recorder.ExecutionResults() {
+		assert.Equal(protocol.ClientMessage_ExecutionResult_SUCCESS, result.GetResult())
+	}
+}
+
+func TestActionLastResult(t *testing.T) {
+	assert := assert.New(t)
+
+	client, _ := NewClient("tcp://localhost:1234")
+	thing := newTestThing("thing1")
+	fail := false
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{
+			Name: "reboot",
+			Execute: func(action Action, params []string) error {
+				if fail {
+					return errors.New("Device busy")
+				}
+				return nil
+			},
+		},
+	}
+	assert.Nil(client.Abstract(thing))
+	action := thing.Components[0].Capabilities[0].Actions[0]
+	_, _, at := action.LastResult()
+	assert.True(at.IsZero())
+
+	thingId, componentId, actionName, sequence := "thing1", "main", "reboot", uint64(1)
+	execute := &protocol.ServerMessage_Execute{
+		Sequence: &sequence,
+		Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+	}
+	client.handleAction(execute, time.Now())
+	status, reason, at := action.LastResult()
+	assert.Equal(protocol.ClientMessage_ExecutionResult_SUCCESS, status)
+	assert.Equal("", reason)
+	assert.False(at.IsZero())
+
+	fail = true
+	client.handleAction(execute, time.Now())
+	status, reason, _ = action.LastResult()
+	assert.Equal(protocol.ClientMessage_ExecutionResult_FAILURE, status)
+	assert.Equal("Device busy", reason)
+}
+
+func TestAttributeValueFunc(t *testing.T) {
+	assert := assert.New(t)
+
+	thing := newTestThing("thing1")
+	calls := 0
+	thing.Attributes = []*Attribute{
+		{Name: "firmware", Value: "1.0"},
+		{Name: "uptime", Value: "stale", ValueFunc: func() string {
+			calls++
+			return fmt.Sprintf("%d", calls)
+		}},
+	}
+	attributes := thing.Protocol().GetAttributes()
+	assert.Equal("1.0", attributes[0].GetValue())
+	assert.Equal("1", attributes[1].GetValue())
+	assert.Equal("2", thing.Protocol().GetAttributes()[1].GetValue())
+}
@@ -0,0 +1,162 @@
+package sdk
+
+import (
+	"fmt"
+	"github.com/connctd/sdk-go/protocol"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ValueCodec encodes and decodes the values of a custom ValueType. On the
+// wire custom values are transported as one of the builtin primitive types.
+type ValueCodec interface {
+	// Primitive returns the builtin ValueType used to transport the values
+	Primitive() ValueType
+	// Encode converts a value into its string representation
+	Encode(v interface{}) (string, error)
+	// Decode parses the string representation of a value
+	Decode(s string) (interface{}, error)
+}
+
+var (
+	valueCodecsLock = &sync.RWMutex{}
+	valueCodecs     = make(map[ValueType]ValueCodec)
+)
+
+// RegisterValueType registers a custom ValueType with the given name and
+// returns it. Values of the type are encoded by the codec and checked by
+// it whenever a property of the type is updated. Custom types should be
+// registered during initialization, before any client is created.
+func RegisterValueType(name string, codec ValueCodec) (ValueType, error) {
+	name = strings.ToUpper(name)
+	if primitive := codec.Primitive(); primitive != Boolean && primitive != String && primitive != Number {
+		return String, fmt.Errorf("ValueType %s must be transported as a builtin type", name)
+	}
+	valueCodecsLock.Lock()
+	defer valueCodecsLock.Unlock()
+	for _, registered := range ValueTypeStrings {
+		if registered == name {
+			return String, fmt.Errorf("ValueType %s is already registered", name)
+		}
+	}
+	if len(ValueTypeStrings) > 255 {
+		return String, fmt.Errorf("Too many ValueTypes registered")
+	}
+	valueType := ValueType(len(ValueTypeStrings))
+	// Copy on write, so names returned by valueTypeNames never change
+	names := make([]string, len(ValueTypeStrings), len(ValueTypeStrings)+1)
+	copy(names, ValueTypeStrings)
+	ValueTypeStrings = append(names, name)
+	valueCodecs[valueType] = codec
+	return valueType, nil
+}
+
+// valueTypeNames returns the names of all ValueTypes, indexed by type. The
+// returned slice must not be modified.
+func valueTypeNames() []string {
+	valueCodecsLock.RLock()
+	defer valueCodecsLock.RUnlock()
+	return ValueTypeStrings
+}
+
+func valueCodec(v ValueType) ValueCodec {
+	valueCodecsLock.RLock()
+	defer valueCodecsLock.RUnlock()
+	return valueCodecs[v]
+}
+
+// primitive returns the builtin type transporting values of this type
+func (v ValueType) primitive() ValueType {
+	if codec := valueCodec(v); codec != nil {
+		return codec.Primitive()
+	}
+	return v
+}
+
+// check verifies that a raw value is a valid value of this type
+func (v ValueType) check(raw string) error {
+	if codec := valueCodec(v); codec != nil {
+		_, err := codec.Decode(raw)
+		return err
+	}
+	switch v {
+	case Boolean:
+		if _, err := strconv.ParseBool(raw); err != nil {
+			return fmt.Errorf("%q is not a %s", raw, v)
+		}
+	case Number:
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return fmt.Errorf("%q is not a %s", raw, v)
+		}
+	}
+	return nil
+}
+
+// ValueTypePolicy decides how incoming protocol values with a missing or
+// unknown value type, like one added in a newer server version, are
+// treated
+type ValueTypePolicy byte
+
+const (
+	// LenientValueTypes treats missing and unknown value types as String,
+	// the raw value is kept
+	LenientValueTypes ValueTypePolicy = iota
+	// StrictValueTypes rejects values with a missing or unknown value type
+	StrictValueTypes
+)
+
+// ValueTypeFromProtocol converts a protocol value type into the builtin
+// ValueType. Unknown types are an error, String is returned for them.
+func ValueTypeFromProtocol(pt protocol.ValueType) (ValueType, error) {
+	switch pt {
+	case protocol.ValueType_BOOLEAN:
+		return Boolean, nil
+	case protocol.ValueType_STRING:
+		return String, nil
+	case protocol.ValueType_NUMBER:
+		return Number, nil
+	}
+	return String, fmt.Errorf("Unknown protocol value type %d", pt)
+}
+
+// valueTypeFromProtocol converts an optional protocol value type according to
+// the policy. The getters of the protocol package report a missing value
+// type as BOOLEAN, so the pointer has to be checked before.
+func valueTypeFromProtocol(pt *protocol.ValueType, policy ValueTypePolicy) (ValueType, error) {
+	if pt == nil {
+		if policy == StrictValueTypes {
+			return String, fmt.Errorf("Value has no value type")
+		}
+		return String, nil
+	}
+	valueType, err := ValueTypeFromProtocol(*pt)
+	if err != nil && policy == StrictValueTypes {
+		return String, err
+	}
+	return valueType, nil
+}
+
+// ValueFromProtocol converts a value received from the server. Missing and
+// unknown value types are handled according to the policy, missing symbols
+// and values are treated as empty.
+func ValueFromProtocol(pv *protocol.Value, policy ValueTypePolicy) (*Value, error) {
+	if pv == nil {
+		return nil, fmt.Errorf("Value is missing")
+	}
+	valueType, err := valueTypeFromProtocol(pv.ValueType, policy)
+	if err != nil {
+		return nil, err
+	}
+	value := &Value{
+		Type:   valueType,
+		Symbol: pv.GetSymbol(),
+		Value:  pv.GetValue(),
+	}
+	if value.Value != "" {
+		if err := valueType.check(value.Value); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
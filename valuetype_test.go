@@ -0,0 +1,139 @@
+package sdk
+
+import (
+	"fmt"
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+var hexColorRegexp = regexp.MustCompile("^#[0-9a-f]{6}$")
+
+var color, colorErr = RegisterValueType("color", hexColorCodec{})
+
+type hexColorCodec struct{}
+
+func (hexColorCodec) Primitive() ValueType {
+	return String
+}
+
+func (hexColorCodec) Encode(v interface{}) (string, error) {
+	rgb, ok := v.([3]uint8)
+	if !ok {
+		return "", fmt.Errorf("Expected [3]uint8, got %T", v)
+	}
+	return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2]), nil
+}
+
+func (hexColorCodec) Decode(s string) (interface{}, error) {
+	if !hexColorRegexp.MatchString(s) {
+		return nil, fmt.Errorf("%s is not a hex color", s)
+	}
+	var rgb [3]uint8
+	_, err := fmt.Sscanf(s, "#%02x%02x%02x", &rgb[0], &rgb[1], &rgb[2])
+	return rgb, err
+}
+
+func TestRegisterValueType(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(colorErr)
+	assert.Equal("COLOR", color.String())
+	assert.Equal(protocol.ValueType_STRING, *color.Protocol())
+
+	_, err := RegisterValueType("COLOR", hexColorCodec{})
+	assert.Error(err)
+
+	property := &Property{Name: "color", Value: &Value{Type: color}}
+	assert.Error(property.Update("red"))
+	// Valid values pass the codec and fail only since nothing is connected
+	assert.Equal(ErrNotConnected, property.UpdateValue([3]uint8{255, 0, 0}))
+}
+
+func TestValueFromProtocolWithoutValueType(t *testing.T) {
+	assert := assert.New(t)
+
+	raw, symbol := "on", ""
+	pv := &protocol.Value{Symbol: &symbol, Value: &raw}
+	value, err := ValueFromProtocol(pv, LenientValueTypes)
+	assert.Nil(err)
+	assert.Equal(&Value{Type: String, Value: "on"}, value)
+
+	_, err = ValueFromProtocol(pv, StrictValueTypes)
+	assert.Error(err)
+
+	_, err = ValueFromProtocol(nil, LenientValueTypes)
+	assert.Error(err)
+}
+
+func TestValueFromProtocol(t *testing.T) {
+	assert := assert.New(t)
+
+	raw, symbol := "21.5", "C"
+	value, err := ValueFromProtocol(&protocol.Value{ValueType: protocol.ValueType_NUMBER.Enum(), Symbol: &symbol, Value: &raw},
+		StrictValueTypes)
+	assert.Nil(err)
+	assert.Equal(&Value{Type: Number, Symbol: "C", Value: "21.5"}, value)
+
+	raw = "warm"
+	_, err = ValueFromProtocol(&protocol.Value{ValueType: protocol.ValueType_NUMBER.Enum(), Value: &raw}, StrictValueTypes)
+	assert.Error(err)
+
+	unknown := protocol.ValueType(42)
+	raw = "#ff0000"
+	value, err = ValueFromProtocol(&protocol.Value{ValueType: &unknown, Value: &raw}, LenientValueTypes)
+	assert.Nil(err)
+	assert.Equal(&Value{Type: String, Value: "#ff0000"}, value)
+	_, err = ValueFromProtocol(&protocol.Value{ValueType: &unknown, Value: &raw}, StrictValueTypes)
+	assert.Error(err)
+}
+
+func TestValueTypeFromProtocol(t *testing.T) {
+	assert := assert.New(t)
+
+	for pt, expected := range map[protocol.ValueType]ValueType{
+		protocol.ValueType_BOOLEAN: Boolean,
+		protocol.ValueType_STRING:  String,
+		protocol.ValueType_NUMBER:  Number,
+	} {
+		valueType, err := ValueTypeFromProtocol(pt)
+		assert.Nil(err)
+		assert.Equal(expected, valueType)
+		// Converting back yields the same protocol type
+		assert.Equal(pt, *valueType.Protocol())
+	}
+	valueType, err := ValueTypeFromProtocol(protocol.ValueType(42))
+	assert.Error(err)
+	assert.Equal(String, valueType)
+}
+
+// registrations makes the names registered by a test run unique with -count
+var registrations int32
+
+func TestRegisterValueTypeConcurrently(t *testing.T) {
+	assert := assert.New(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("concurrent%d", atomic.AddInt32(&registrations, 1))
+			valueType, err := RegisterValueType(name, hexColorCodec{})
+			assert.Nil(err)
+			assert.Nil((&Value{Type: valueType, Value: "#00ff00"}).Validate())
+		}()
+		go func() {
+			defer wg.Done()
+			assert.Equal("NUMBER", Number.String())
+			valueType, err := ValueTypeFromString("STRING")
+			assert.Nil(err)
+			assert.Equal(String, valueType)
+			assert.Nil((&Value{Type: Number, Value: "1"}).Validate())
+		}()
+	}
+	wg.Wait()
+}
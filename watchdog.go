@@ -0,0 +1,26 @@
+package sdk
+
+import (
+	"github.com/connctd/sdk-go/protocol"
+	"time"
+)
+
+// watchHandler logs a warning if the handler of the action addressed by
+// path runs longer than the threshold set via WithHandlerWatchdog. The
+// returned function has to be called once the handler returned.
+func (c *Client) watchHandler(path *protocol.Path) func() {
+	if c.handlerWatchdog <= 0 {
+		return func() {}
+	}
+	start := time.Now()
+	timer := time.AfterFunc(c.handlerWatchdog, func() {
+		c.logger.Error("Action handler is running longer than expected", F("thing", path.GetThingId()),
+			F("component", path.GetComponentId()), F("action", path.GetAction()), F("threshold", c.handlerWatchdog))
+	})
+	return func() {
+		if !timer.Stop() {
+			c.logger.Info("Slow action handler finished", F("thing", path.GetThingId()),
+				F("component", path.GetComponentId()), F("action", path.GetAction()), F("duration", time.Since(start)))
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package sdk
+
+import (
+	"github.com/connctd/sdk-go/protocol"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// channelLogger delivers log messages to a channel, so they can be received
+// from other goroutines
+type channelLogger chan string
+
+func (l channelLogger) Debug(msg string, fields ...Field) {}
+func (l channelLogger) Info(msg string, fields ...Field)  { l <- msg }
+func (l channelLogger) Error(msg string, fields ...Field) { l <- msg }
+
+func TestHandlerWatchdog(t *testing.T) {
+	assert := assert.New(t)
+
+	logs := make(channelLogger, 10)
+	client, _ := NewClient("tcp://localhost:1234", WithStructuredLogger(logs), WithHandlerWatchdog(20*time.Millisecond))
+	thing := newTestThing("thing1")
+	thing.Components[0].Capabilities[0].Actions = []*Action{
+		{
+			Name: "slow",
+			Execute: func(action Action, params []string) error {
+				time.Sleep(50 * time.Millisecond)
+				return nil
+			},
+		},
+		{
+			Name: "fast",
+			Execute: func(action Action, params []string) error {
+				return nil
+			},
+		},
+	}
+	assert.Nil(client.Abstract(thing))
+	thingId, componentId, sequence := "thing1", "main", uint64(1)
+	for _, name := range []string{"fast", "slow"} {
+		actionName := name
+		client.handleAction(&protocol.ServerMessage_Execute{
+			Sequence: &sequence,
+			Path:     &protocol.Path{ThingId: &thingId, ComponentId: &componentId, Action: &actionName},
+		}, time.Now())
+	}
+
+	assert.Equal("Action handler is running longer than expected", <-logs)
+	assert.Equal("Slow action handler finished", <-logs)
+}